@@ -0,0 +1,126 @@
+package main
+
+// Copyright 2016 Nils Decker
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"fmt"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	upnp "github.com/ndecker/fritzbox_exporter/fritzbox_upnp"
+)
+
+const dectService = "urn:dslforum-org:service:X_AVM-DE_Dect:1"
+
+var dect_labels = []string{"gateway", "id", "name"}
+
+var (
+	dect_registered = prometheus.NewDesc(
+		"fritzbox_dect_handset_registered",
+		"DECT handset is registered at the base station (1 = registered)",
+		dect_labels,
+		nil,
+	)
+	dect_info = prometheus.NewDesc(
+		"fritzbox_dect_handset_info",
+		"Model and firmware of a DECT handset",
+		append(dect_labels, "model", "firmware"),
+		nil,
+	)
+	dect_update_available = prometheus.NewDesc(
+		"fritzbox_dect_handset_update_available",
+		"Firmware update available for the handset (1 = available)",
+		dect_labels,
+		nil,
+	)
+	dect_battery = prometheus.NewDesc(
+		"fritzbox_dect_handset_battery_percent",
+		"Battery level of a DECT handset, if reported",
+		dect_labels,
+		nil,
+	)
+	dect_signal = prometheus.NewDesc(
+		"fritzbox_dect_handset_signal_percent",
+		"Signal strength of a DECT handset, if reported",
+		dect_labels,
+		nil,
+	)
+	dect_handsets = prometheus.NewDesc(
+		"fritzbox_dect_handsets",
+		"Number of DECT handsets known to the base station",
+		[]string{"gateway"},
+		nil,
+	)
+)
+
+// DECTCollector exports the DECT handsets of the base station.
+type DECTCollector struct {
+	Fritzbox *FritzboxCollector
+}
+
+func (c *DECTCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- dect_registered
+	ch <- dect_info
+	ch <- dect_update_available
+	ch <- dect_battery
+	ch <- dect_signal
+	ch <- dect_handsets
+}
+
+func (c *DECTCollector) Collect(ch chan<- prometheus.Metric) {
+	root := c.Fritzbox.currentRoot()
+	if root == nil || root.Services[dectService] == nil {
+		return
+	}
+
+	err := c.collect(ch, root)
+	if err != nil {
+		fmt.Println("cannot collect DECT handsets:", err)
+		collect_errors.Inc()
+	}
+}
+
+func (c *DECTCollector) collect(ch chan<- prometheus.Metric, root *upnp.Root) error {
+	gateway := c.Fritzbox.Gateway
+
+	res, err := root.Call(dectService, "GetNumberOfDectEntries")
+	if err != nil {
+		return err
+	}
+	n, _ := res.GetFloat("NumberOfEntries")
+	ch <- prometheus.MustNewConstMetric(dect_handsets, prometheus.GaugeValue, n, gateway)
+
+	for i := 0; i < int(n); i++ {
+		entry, err := root.Call(dectService, "GetGenericDectEntry", upnp.ActionArgument{Name: "NewIndex", Value: i})
+		if err != nil {
+			return err
+		}
+
+		labels := []string{gateway, entry.GetString("ID"), entry.GetString("Name")}
+
+		emitResult(ch, dect_registered, prometheus.GaugeValue, entry, "Active", labels...)
+		emitResult(ch, dect_update_available, prometheus.GaugeValue, entry, "UpdateAvailable", labels...)
+
+		ch <- prometheus.MustNewConstMetric(dect_info, prometheus.GaugeValue, 1, append(labels,
+			entry.GetString("Model"),
+			entry.GetString(firstResult(entry, "FirmwareVersion", "Firmware")),
+		)...)
+
+		// only some firmware versions report battery and signal of the handsets
+		emitResult(ch, dect_battery, prometheus.GaugeValue, entry, firstResult(entry, "BatteryLevel", "Battery"), labels...)
+		emitResult(ch, dect_signal, prometheus.GaugeValue, entry, firstResult(entry, "SignalStrength", "Signal"), labels...)
+	}
+	return nil
+}
@@ -0,0 +1,164 @@
+package main
+
+// Copyright 2016 Nils Decker
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	upnp "github.com/ndecker/fritzbox_exporter/fritzbox_upnp"
+)
+
+const deviceInfoService = "urn:dslforum-org:service:DeviceInfo:1"
+
+var (
+	device_info = prometheus.NewDesc(
+		"fritzbox_info",
+		"Model, serial number, hardware and software version of the FRITZ!Box",
+		[]string{"gateway", "model", "serial", "hardware_version", "software_version"},
+		nil,
+	)
+	device_uptime = prometheus.NewDesc(
+		"fritzbox_uptime_seconds",
+		"Time since the FRITZ!Box was started",
+		[]string{"gateway"},
+		nil,
+	)
+	device_reboots = prometheus.NewDesc(
+		"fritzbox_reboots",
+		"Number of reboots noticed since the exporter started",
+		[]string{"gateway"},
+		nil,
+	)
+	device_log_entries = prometheus.NewDesc(
+		"fritzbox_device_log_entries",
+		"Number of entries in the event log of the FRITZ!Box",
+		[]string{"gateway"},
+		nil,
+	)
+)
+
+// DeviceInfoCollector exports model and firmware of the box and notices
+// reboots by the uptime going backwards.
+type DeviceInfoCollector struct {
+	Fritzbox *FritzboxCollector
+
+	mu         sync.Mutex
+	lastUptime float64 // -1 until the uptime was read once
+	reboots    uint64
+}
+
+func NewDeviceInfoCollector(fc *FritzboxCollector) *DeviceInfoCollector {
+	return &DeviceInfoCollector{
+		Fritzbox:   fc,
+		lastUptime: -1,
+	}
+}
+
+func (c *DeviceInfoCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- device_info
+	ch <- device_uptime
+	ch <- device_reboots
+	ch <- device_log_entries
+}
+
+func (c *DeviceInfoCollector) Collect(ch chan<- prometheus.Metric) {
+	root := c.Fritzbox.currentRoot()
+	if root == nil || root.Services[deviceInfoService] == nil {
+		return
+	}
+
+	err := c.collect(ch, root)
+	if err != nil {
+		fmt.Println("cannot collect device info:", err)
+		collect_errors.Inc()
+	}
+}
+
+func (c *DeviceInfoCollector) collect(ch chan<- prometheus.Metric, root *upnp.Root) error {
+	gateway := c.Fritzbox.Gateway
+
+	info, err := root.Call(deviceInfoService, "GetInfo")
+	if err != nil {
+		return err
+	}
+
+	ch <- prometheus.MustNewConstMetric(device_info, prometheus.GaugeValue, 1, gateway,
+		info.GetString("ModelName"),
+		info.GetString("SerialNumber"),
+		info.GetString("HardwareVersion"),
+		info.GetString("SoftwareVersion"),
+	)
+
+	if uptime, ok := info.GetFloat("UpTime"); ok {
+		ch <- prometheus.MustNewConstMetric(device_uptime, prometheus.GaugeValue, uptime, gateway)
+		c.updateUptime(uptime)
+	}
+
+	c.mu.Lock()
+	ch <- prometheus.MustNewConstMetric(device_reboots, prometheus.CounterValue, float64(c.reboots), gateway)
+	c.mu.Unlock()
+
+	log, err := deviceLog(root)
+	if err != nil {
+		return err
+	}
+	if log != nil {
+		ch <- prometheus.MustNewConstMetric(device_log_entries, prometheus.GaugeValue, float64(len(log)), gateway)
+	}
+
+	return nil
+}
+
+func (c *DeviceInfoCollector) updateUptime(uptime float64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.lastUptime >= 0 && uptime < c.lastUptime {
+		c.reboots++
+	}
+	c.lastUptime = uptime
+}
+
+// deviceLog returns the entries of the event log, newest first. It returns nil
+// if the box does not provide the log.
+func deviceLog(root *upnp.Root) ([]string, error) {
+	var action string
+	switch {
+	case root.HasAction(deviceInfoService, "X_AVM-DE_GetDeviceLog"):
+		action = "X_AVM-DE_GetDeviceLog"
+	case root.HasAction(deviceInfoService, "GetDeviceLog"):
+		action = "GetDeviceLog"
+	default:
+		return nil, nil
+	}
+
+	res, err := root.Call(deviceInfoService, action)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := []string{}
+	for _, line := range strings.Split(res.GetString("DeviceLog"), "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" {
+			entries = append(entries, line)
+		}
+	}
+	return entries, nil
+}
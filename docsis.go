@@ -0,0 +1,116 @@
+package main
+
+// Copyright 2016 Nils Decker
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"fmt"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	web "github.com/ndecker/fritzbox_exporter/fritzbox_web"
+)
+
+var docsis_labels = []string{"gateway", "direction", "docsis", "channel_id"}
+
+var (
+	docsis_channel_info = prometheus.NewDesc(
+		"fritzbox_docsis_channel_info",
+		"Modulation of a DOCSIS channel",
+		append(docsis_labels, "modulation"),
+		nil,
+	)
+	docsis_channel_frequency = prometheus.NewDesc(
+		"fritzbox_docsis_channel_frequency_mhz",
+		"Frequency of a DOCSIS channel, the lower end for OFDM channels",
+		docsis_labels,
+		nil,
+	)
+	docsis_channel_power = prometheus.NewDesc(
+		"fritzbox_docsis_channel_power_dbmv",
+		"Power level of a DOCSIS channel",
+		docsis_labels,
+		nil,
+	)
+	docsis_channel_mse = prometheus.NewDesc(
+		"fritzbox_docsis_channel_mse_db",
+		"Mean square error of a DOCSIS 3.0 downstream channel",
+		docsis_labels,
+		nil,
+	)
+	docsis_channel_mer = prometheus.NewDesc(
+		"fritzbox_docsis_channel_mer_db",
+		"Modulation error ratio of a DOCSIS 3.1 downstream channel",
+		docsis_labels,
+		nil,
+	)
+	docsis_channel_corrected_errors = prometheus.NewDesc(
+		"fritzbox_docsis_channel_corrected_errors",
+		"Number of corrected errors of a downstream channel",
+		docsis_labels,
+		nil,
+	)
+	docsis_channel_uncorrectable_errors = prometheus.NewDesc(
+		"fritzbox_docsis_channel_uncorrectable_errors",
+		"Number of uncorrectable errors of a downstream channel",
+		docsis_labels,
+		nil,
+	)
+)
+
+// DocsisCollector exports the channels of the cable connection of Fritz!Box Cable models.
+type DocsisCollector struct {
+	Gateway string
+	Session *web.Session
+}
+
+func (c *DocsisCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- docsis_channel_info
+	ch <- docsis_channel_frequency
+	ch <- docsis_channel_power
+	ch <- docsis_channel_mse
+	ch <- docsis_channel_mer
+	ch <- docsis_channel_corrected_errors
+	ch <- docsis_channel_uncorrectable_errors
+}
+
+func (c *DocsisCollector) Collect(ch chan<- prometheus.Metric) {
+	info, err := c.Session.DocsisInfo()
+	if err != nil {
+		fmt.Println("cannot get DOCSIS information:", err)
+		collect_errors.Inc()
+		return
+	}
+
+	c.collectChannels(ch, "down", "3.0", info.Downstream.Docsis30)
+	c.collectChannels(ch, "down", "3.1", info.Downstream.Docsis31)
+	c.collectChannels(ch, "up", "3.0", info.Upstream.Docsis30)
+	c.collectChannels(ch, "up", "3.1", info.Upstream.Docsis31)
+}
+
+func (c *DocsisCollector) collectChannels(ch chan<- prometheus.Metric, direction, docsis string, channels []*web.DocsisChannel) {
+	for _, channel := range channels {
+		labels := []string{c.Gateway, direction, docsis, channel.ChannelID.String()}
+
+		ch <- prometheus.MustNewConstMetric(docsis_channel_info, prometheus.GaugeValue, 1,
+			append(labels, channel.Modulation.String())...)
+
+		emitValue(ch, docsis_channel_frequency, prometheus.GaugeValue, channel.Frequency, labels...)
+		emitValue(ch, docsis_channel_power, prometheus.GaugeValue, channel.PowerLevel, labels...)
+		emitValue(ch, docsis_channel_mse, prometheus.GaugeValue, channel.MSE, labels...)
+		emitValue(ch, docsis_channel_mer, prometheus.GaugeValue, channel.MER, labels...)
+		emitValue(ch, docsis_channel_corrected_errors, prometheus.CounterValue, channel.CorrErrors, labels...)
+		emitValue(ch, docsis_channel_uncorrectable_errors, prometheus.CounterValue, channel.NonCorrErrors, labels...)
+	}
+}
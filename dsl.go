@@ -0,0 +1,178 @@
+package main
+
+// Copyright 2016 Nils Decker
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"fmt"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	upnp "github.com/ndecker/fritzbox_exporter/fritzbox_upnp"
+)
+
+const dslService = "urn:dslforum-org:service:WANDSLInterfaceConfig:1"
+
+var dsl_labels = []string{"gateway", "direction"}
+
+var (
+	dsl_status = prometheus.NewDesc(
+		"fritzbox_dsl_status",
+		"Status of the DSL line (Up = 1)",
+		[]string{"gateway"},
+		nil,
+	)
+	dsl_info = prometheus.NewDesc(
+		"fritzbox_dsl_info",
+		"Modulation, profile and data path of the DSL line",
+		[]string{"gateway", "modulation", "profile", "data_path"},
+		nil,
+	)
+	dsl_datarate = prometheus.NewDesc(
+		"fritzbox_dsl_datarate_kbps",
+		"Current data rate in kbit/s",
+		dsl_labels,
+		nil,
+	)
+	dsl_max_datarate = prometheus.NewDesc(
+		"fritzbox_dsl_max_datarate_kbps",
+		"Maximum attainable data rate in kbit/s",
+		dsl_labels,
+		nil,
+	)
+	dsl_snr_margin = prometheus.NewDesc(
+		"fritzbox_dsl_snr_margin_db",
+		"Signal to noise ratio margin",
+		dsl_labels,
+		nil,
+	)
+	dsl_attenuation = prometheus.NewDesc(
+		"fritzbox_dsl_attenuation_db",
+		"Line attenuation",
+		dsl_labels,
+		nil,
+	)
+	dsl_power = prometheus.NewDesc(
+		"fritzbox_dsl_power_dbm",
+		"Output power",
+		dsl_labels,
+		nil,
+	)
+	dsl_interleave_depth = prometheus.NewDesc(
+		"fritzbox_dsl_interleave_depth",
+		"Interleave depth",
+		[]string{"gateway"},
+		nil,
+	)
+	dsl_errors = prometheus.NewDesc(
+		"fritzbox_dsl_errors",
+		"Number of errors on the DSL line by type (fec, crc, hec). Errors in direction up are counted by the central office",
+		[]string{"gateway", "direction", "type"},
+		nil,
+	)
+	dsl_errored_seconds = prometheus.NewDesc(
+		"fritzbox_dsl_errored_seconds",
+		"Number of seconds with errors",
+		[]string{"gateway"},
+		nil,
+	)
+	dsl_severely_errored_seconds = prometheus.NewDesc(
+		"fritzbox_dsl_severely_errored_seconds",
+		"Number of seconds with severe errors",
+		[]string{"gateway"},
+		nil,
+	)
+)
+
+// DSLCollector exports the line quality of the DSL connection.
+type DSLCollector struct {
+	Fritzbox *FritzboxCollector
+}
+
+func (c *DSLCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- dsl_status
+	ch <- dsl_info
+	ch <- dsl_datarate
+	ch <- dsl_max_datarate
+	ch <- dsl_snr_margin
+	ch <- dsl_attenuation
+	ch <- dsl_power
+	ch <- dsl_interleave_depth
+	ch <- dsl_errors
+	ch <- dsl_errored_seconds
+	ch <- dsl_severely_errored_seconds
+}
+
+func (c *DSLCollector) Collect(ch chan<- prometheus.Metric) {
+	root := c.Fritzbox.currentRoot()
+	if root == nil || root.Services[dslService] == nil {
+		return
+	}
+
+	err := c.collect(ch, root)
+	if err != nil {
+		fmt.Println("cannot collect DSL metrics:", err)
+		collect_errors.Inc()
+	}
+}
+
+func (c *DSLCollector) collect(ch chan<- prometheus.Metric, root *upnp.Root) error {
+	gateway := c.Fritzbox.Gateway
+
+	info, err := root.Call(dslService, "GetInfo")
+	if err != nil {
+		return err
+	}
+
+	var up float64
+	if info.GetString("Status") == "Up" {
+		up = 1
+	}
+	ch <- prometheus.MustNewConstMetric(dsl_status, prometheus.GaugeValue, up, gateway)
+
+	// noise margin, attenuation and power are reported in 0.1 dB
+	for _, dir := range []struct{ label, prefix string }{{"up", "Upstream"}, {"down", "Downstream"}} {
+		emitResult(ch, dsl_datarate, prometheus.GaugeValue, info, dir.prefix+"CurrRate", gateway, dir.label)
+		emitResult(ch, dsl_max_datarate, prometheus.GaugeValue, info, dir.prefix+"MaxRate", gateway, dir.label)
+		emitScaledResult(ch, dsl_snr_margin, prometheus.GaugeValue, info, dir.prefix+"NoiseMargin", 0.1, gateway, dir.label)
+		emitScaledResult(ch, dsl_attenuation, prometheus.GaugeValue, info, dir.prefix+"Attenuation", 0.1, gateway, dir.label)
+		emitScaledResult(ch, dsl_power, prometheus.GaugeValue, info, dir.prefix+"Power", 0.1, gateway, dir.label)
+	}
+	emitResult(ch, dsl_interleave_depth, prometheus.GaugeValue, info, "InterleaveDepth", gateway)
+
+	var avm upnp.Result
+	if root.HasAction(dslService, "X_AVM-DE_GetDSLInfo") {
+		avm, err = root.Call(dslService, "X_AVM-DE_GetDSLInfo")
+		if err != nil {
+			return err
+		}
+	}
+	ch <- prometheus.MustNewConstMetric(dsl_info, prometheus.GaugeValue, 1, gateway,
+		avm.GetString("ModulationType"), avm.GetString("CurrentProfile"), info.GetString("DataPath"))
+
+	stats, err := root.Call(dslService, "GetStatisticsTotal")
+	if err != nil {
+		return err
+	}
+
+	// the ATUC values are the errors seen by the central office
+	for _, e := range []struct{ label, name string }{{"fec", "FECErrors"}, {"crc", "CRCErrors"}, {"hec", "HECErrors"}} {
+		emitResult(ch, dsl_errors, prometheus.CounterValue, stats, e.name, gateway, "down", e.label)
+		emitResult(ch, dsl_errors, prometheus.CounterValue, stats, "ATUC"+e.name, gateway, "up", e.label)
+	}
+	emitResult(ch, dsl_errored_seconds, prometheus.CounterValue, stats, "ErroredSecs", gateway)
+	emitResult(ch, dsl_severely_errored_seconds, prometheus.CounterValue, stats, "SeverelyErroredSecs", gateway)
+
+	return nil
+}
@@ -0,0 +1,88 @@
+package main
+
+// Copyright 2016 Nils Decker
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"fmt"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	web "github.com/ndecker/fritzbox_exporter/fritzbox_web"
+)
+
+var (
+	ecostat_cpu_temperature = prometheus.NewDesc(
+		"fritzbox_cpu_temperature_celsius",
+		"Temperature of the CPU",
+		[]string{"gateway"},
+		nil,
+	)
+	ecostat_cpu_load = prometheus.NewDesc(
+		"fritzbox_cpu_load_percent",
+		"Load of the CPU",
+		[]string{"gateway"},
+		nil,
+	)
+	ecostat_memory = prometheus.NewDesc(
+		"fritzbox_memory_usage_percent",
+		"Usage of the RAM by type (fixed = system, dynamic = applications, free)",
+		[]string{"gateway", "type"},
+		nil,
+	)
+	ecostat_power = prometheus.NewDesc(
+		"fritzbox_power_consumption_percent",
+		"Current power consumption of a subsystem in percent of its maximum",
+		[]string{"gateway", "subsystem"},
+		nil,
+	)
+)
+
+// EcoStatCollector exports the system load and the power consumption of the
+// energy monitor.
+type EcoStatCollector struct {
+	Gateway string
+	Session *web.Session
+}
+
+func (c *EcoStatCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- ecostat_cpu_temperature
+	ch <- ecostat_cpu_load
+	ch <- ecostat_memory
+	ch <- ecostat_power
+}
+
+func (c *EcoStatCollector) Collect(ch chan<- prometheus.Metric) {
+	stat, err := c.Session.EcoStat()
+	if err != nil {
+		fmt.Println("cannot get system load:", err)
+		collect_errors.Inc()
+	} else {
+		emitValue(ch, ecostat_cpu_temperature, prometheus.GaugeValue, stat.CPUTemperature, c.Gateway)
+		emitValue(ch, ecostat_cpu_load, prometheus.GaugeValue, stat.CPULoad, c.Gateway)
+		emitValue(ch, ecostat_memory, prometheus.GaugeValue, stat.RAMFixed, c.Gateway, "fixed")
+		emitValue(ch, ecostat_memory, prometheus.GaugeValue, stat.RAMDynamic, c.Gateway, "dynamic")
+		emitValue(ch, ecostat_memory, prometheus.GaugeValue, stat.RAMFree, c.Gateway, "free")
+	}
+
+	consumers, err := c.Session.EnergyUsage()
+	if err != nil {
+		fmt.Println("cannot get energy usage:", err)
+		collect_errors.Inc()
+		return
+	}
+	for _, consumer := range consumers {
+		emitValue(ch, ecostat_power, prometheus.GaugeValue, consumer.Percent, c.Gateway, consumer.Name.String())
+	}
+}
@@ -0,0 +1,245 @@
+package main
+
+// Copyright 2016 Nils Decker
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	upnp "github.com/ndecker/fritzbox_exporter/fritzbox_upnp"
+	web "github.com/ndecker/fritzbox_exporter/fritzbox_web"
+)
+
+// Format of date and time in the event log
+const logTimeLayout = "02.01.06 15:04:05"
+
+// Categories of log messages by their text, English and German. The first
+// match wins, messages without match are "system".
+var logCategories = []struct {
+	category string
+	re       *regexp.Regexp
+}{
+	{"telephony", regexp.MustCompile(`(?i)telephon|telefon|\bSIP\b|\bcall|anruf`)},
+	{"dsl", regexp.MustCompile(`(?i)\bDSL\b|synchroni`)},
+	{"internet", regexp.MustCompile(`(?i)internet|\bPPP|prefix|präfix|\bWAN\b`)},
+	{"dhcp", regexp.MustCompile(`(?i)DHCP`)},
+	{"wlan", regexp.MustCompile(`(?i)WLAN|Wi-Fi|\bWPA`)},
+	{"usb", regexp.MustCompile(`(?i)\bUSB\b`)},
+}
+
+// Categories of the groups of the web interface
+var logGroups = map[string]string{
+	"net":  "internet",
+	"fon":  "telephony",
+	"wlan": "wlan",
+	"usb":  "usb",
+}
+
+var (
+	log_events = prometheus.NewDesc(
+		"fritzbox_log_events",
+		"Number of event log entries since the exporter started by category and message ID (web interface only)",
+		[]string{"gateway", "category", "message_id"},
+		nil,
+	)
+	log_forward_queued = prometheus.NewDesc(
+		"fritzbox_log_forward_queued",
+		"Number of event log entries waiting to be forwarded",
+		[]string{"gateway", "forwarder"},
+		nil,
+	)
+	log_forward_dropped = prometheus.NewDesc(
+		"fritzbox_log_forward_dropped",
+		"Number of event log entries dropped because the forwarder was unavailable for too long",
+		[]string{"gateway", "forwarder"},
+		nil,
+	)
+)
+
+// An entry of the event log
+type logEntry struct {
+	Time     time.Time // zero if the time cannot be parsed
+	Message  string
+	ID       string
+	Category string
+}
+
+func (e *logEntry) key() string {
+	return e.Time.String() + " " + e.Message
+}
+
+type logEventKey struct {
+	category string
+	id       string
+}
+
+// EventLogCollector reads the event log incrementally and counts the new
+// entries by category. New entries can be forwarded e.g. to syslog.
+type EventLogCollector struct {
+	Fritzbox *FritzboxCollector
+	Session  *web.Session // optional, the web interface also reports message IDs
+
+	queues []*logQueue
+
+	mu     sync.Mutex
+	seen   map[string]bool // keys of the entries of the last scrape, nil before the first scrape
+	events map[logEventKey]uint64
+}
+
+func NewEventLogCollector(fc *FritzboxCollector, session *web.Session, forwarders ...LogForwarder) *EventLogCollector {
+	c := &EventLogCollector{
+		Fritzbox: fc,
+		Session:  session,
+		events:   make(map[logEventKey]uint64),
+	}
+	for _, f := range forwarders {
+		c.queues = append(c.queues, newLogQueue(f, fc.Gateway))
+	}
+	return c
+}
+
+func (c *EventLogCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- log_events
+	ch <- log_forward_queued
+	ch <- log_forward_dropped
+}
+
+func (c *EventLogCollector) Collect(ch chan<- prometheus.Metric) {
+	root := c.Fritzbox.currentRoot()
+	if root == nil {
+		return
+	}
+
+	entries, err := c.loadLog(root)
+	if err != nil {
+		fmt.Println("cannot read event log:", err)
+		collect_errors.Inc()
+	}
+
+	c.mu.Lock()
+	var added []*logEntry
+	if err == nil {
+		added = c.update(entries)
+	}
+
+	gateway := c.Fritzbox.Gateway
+	for k, n := range c.events {
+		ch <- prometheus.MustNewConstMetric(log_events, prometheus.CounterValue, float64(n), gateway, k.category, k.id)
+	}
+	c.mu.Unlock()
+
+	for _, q := range c.queues {
+		if len(added) > 0 {
+			q.push(added)
+		}
+
+		queued, dropped := q.stats()
+		name := q.Forwarder.Name()
+		ch <- prometheus.MustNewConstMetric(log_forward_queued, prometheus.GaugeValue, float64(queued), gateway, name)
+		ch <- prometheus.MustNewConstMetric(log_forward_dropped, prometheus.CounterValue, float64(dropped), gateway, name)
+	}
+}
+
+// update counts the entries that were not in the log at the last scrape and
+// returns them, oldest first. The box rewrites repeated messages with a new
+// time, so the entries of the whole log are compared and not only the newest
+// one. The first scrape only remembers the entries.
+func (c *EventLogCollector) update(entries []*logEntry) []*logEntry {
+	seen := make(map[string]bool, len(entries))
+	var added []*logEntry
+	for _, e := range entries {
+		key := e.key()
+		if !c.seen[key] {
+			added = append(added, e)
+		}
+		seen[key] = true
+	}
+
+	first := c.seen == nil
+	c.seen = seen
+	if first {
+		return nil
+	}
+
+	for i, j := 0, len(added)-1; i < j; i, j = i+1, j-1 {
+		added[i], added[j] = added[j], added[i]
+	}
+	for _, e := range added {
+		c.events[logEventKey{e.Category, e.ID}]++
+	}
+	return added
+}
+
+// loadLog reads the event log, newest first. The web interface is preferred
+// because it reports message IDs.
+func (c *EventLogCollector) loadLog(root *upnp.Root) ([]*logEntry, error) {
+	if c.Session != nil {
+		log, err := c.Session.Log()
+		if err != nil {
+			return nil, err
+		}
+
+		var entries []*logEntry
+		for _, l := range log {
+			t, _ := time.ParseInLocation(logTimeLayout, l.Date.String()+" "+l.Time.String(), time.Local)
+			entries = append(entries, &logEntry{
+				Time:     t,
+				Message:  l.Message.String(),
+				ID:       l.ID.String(),
+				Category: logCategory(l.Message.String(), l.Group.String()),
+			})
+		}
+		return entries, nil
+	}
+
+	lines, err := deviceLog(root)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []*logEntry
+	for _, line := range lines {
+		e := &logEntry{Message: line}
+		if len(line) > len(logTimeLayout) {
+			t, err := time.ParseInLocation(logTimeLayout, line[:len(logTimeLayout)], time.Local)
+			if err == nil {
+				e.Time = t
+				e.Message = strings.TrimSpace(line[len(logTimeLayout):])
+			}
+		}
+		e.Category = logCategory(e.Message, "")
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// logCategory classifies a message by its text or else by the group of the
+// web interface.
+func logCategory(msg, group string) string {
+	for _, c := range logCategories {
+		if c.re.MatchString(msg) {
+			return c.category
+		}
+	}
+	if c, ok := logGroups[group]; ok {
+		return c
+	}
+	return "system"
+}
@@ -0,0 +1,103 @@
+package main
+
+// Copyright 2016 Nils Decker
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// logEntries returns the entries of a log (newest first), given as minute
+// of the entry and message.
+func logEntries(entries ...interface{}) []*logEntry {
+	var res []*logEntry
+	for i := 0; i < len(entries); i += 2 {
+		res = append(res, &logEntry{
+			Time:     time.Date(2026, 10, 18, 12, entries[i].(int), 0, 0, time.Local),
+			Message:  entries[i+1].(string),
+			Category: "internet",
+		})
+	}
+	return res
+}
+
+func messages(entries []*logEntry) []string {
+	var res []string
+	for _, e := range entries {
+		res = append(res, e.Message)
+	}
+	return res
+}
+
+func TestUpdateEventLog(t *testing.T) {
+	type scrape struct {
+		entries []*logEntry
+		added   []string // expected new messages, oldest first
+	}
+
+	tests := []struct {
+		name    string
+		scrapes []scrape
+	}{
+		{
+			name: "new entries",
+			scrapes: []scrape{
+				{entries: logEntries(2, "b", 1, "a")},
+				{entries: logEntries(2, "b", 1, "a")},
+				{entries: logEntries(4, "d", 3, "c", 2, "b", 1, "a"), added: []string{"c", "d"}},
+			},
+		},
+		{
+			name: "repeated message rewritten",
+			scrapes: []scrape{
+				{entries: logEntries(3, "timeout [2 messages since 18.10.26 12:01:00]", 2, "b", 1, "a")},
+				{
+					entries: logEntries(5, "timeout [3 messages since 18.10.26 12:01:00]", 2, "b", 1, "a"),
+					added:   []string{"timeout [3 messages since 18.10.26 12:01:00]"},
+				},
+				{
+					entries: logEntries(6, "c", 5, "timeout [3 messages since 18.10.26 12:01:00]", 2, "b", 1, "a"),
+					added:   []string{"c"},
+				},
+			},
+		},
+		{
+			name: "cleared log",
+			scrapes: []scrape{
+				{entries: logEntries(2, "b", 1, "a")},
+				{entries: nil},
+				{entries: logEntries(3, "c"), added: []string{"c"}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		c := NewEventLogCollector(nil, nil)
+
+		var count uint64
+		for i, s := range tt.scrapes {
+			added := c.update(s.entries)
+			if got := messages(added); !reflect.DeepEqual(got, s.added) {
+				t.Errorf("%s, scrape %d: got new entries %q, want %q", tt.name, i, got, s.added)
+			}
+
+			count += uint64(len(s.added))
+			if got := c.events[logEventKey{"internet", ""}]; got != count {
+				t.Errorf("%s, scrape %d: got %d events, want %d", tt.name, i, got, count)
+			}
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package fritzbox_upnp
+
+// Copyright 2016 Nils Decker
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+var ErrCircuitOpen = errors.New("circuit breaker open")
+
+// State of a CircuitBreaker
+type BreakerState int
+
+const (
+	BreakerClosed   BreakerState = iota // Requests pass
+	BreakerOpen                         // Requests fail without contacting the device
+	BreakerHalfOpen                     // A single probe request is allowed
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// A CircuitBreaker stops requests to a device after too many transient failures
+// in a row. After OpenTimeout a single probe request is let through; if it
+// succeeds the breaker closes again.
+type CircuitBreaker struct {
+	FailureThreshold int           // Consecutive failures until the breaker opens
+	OpenTimeout      time.Duration // Time until a probe request is allowed
+
+	mu       sync.Mutex
+	state    BreakerState
+	failures int
+	openedAt time.Time
+	probing  bool
+	trips    uint64
+}
+
+// NewCircuitBreaker creates a closed breaker.
+func NewCircuitBreaker(failureThreshold int, openTimeout time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{
+		FailureThreshold: failureThreshold,
+		OpenTimeout:      openTimeout,
+	}
+}
+
+// Allow returns ErrCircuitOpen if no request may be sent right now.
+// Every allowed request has to be followed by Success or Failure.
+func (b *CircuitBreaker) Allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case BreakerOpen:
+		if time.Since(b.openedAt) < b.OpenTimeout {
+			return ErrCircuitOpen
+		}
+		b.state = BreakerHalfOpen
+		b.probing = true
+		return nil
+	case BreakerHalfOpen:
+		if b.probing {
+			return ErrCircuitOpen
+		}
+		b.probing = true
+	}
+	return nil
+}
+
+// Success records a request that reached the device.
+func (b *CircuitBreaker) Success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.state = BreakerClosed
+	b.failures = 0
+	b.probing = false
+}
+
+// Failure records a transient failure.
+func (b *CircuitBreaker) Failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+	b.failures++
+
+	if b.state == BreakerHalfOpen || (b.state == BreakerClosed && b.failures >= b.FailureThreshold) {
+		b.state = BreakerOpen
+		b.openedAt = time.Now()
+		b.trips++
+	}
+}
+
+// State returns the current state of the breaker.
+func (b *CircuitBreaker) State() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == BreakerOpen && time.Since(b.openedAt) >= b.OpenTimeout {
+		return BreakerHalfOpen
+	}
+	return b.state
+}
+
+// Trips returns how often the breaker has opened.
+func (b *CircuitBreaker) Trips() uint64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.trips
+}
@@ -0,0 +1,232 @@
+package fritzbox_upnp
+
+// Copyright 2016 Nils Decker
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Timeout of a request if the Client has no HTTPClient. A rebooting device may
+// accept connections but never answer.
+const DefaultTimeout = 30 * time.Second
+
+var defaultHTTPClient = &http.Client{Timeout: DefaultTimeout}
+
+// A Client sends the requests for all services of one device.
+// All Roots loaded through a Client share its retry policy, circuit breaker and limiter.
+type Client struct {
+	HTTPClient *http.Client    // nil means a client with DefaultTimeout
+	Retry      RetryPolicy     // Retry policy for transient errors
+	Breaker    *CircuitBreaker // Optional circuit breaker for the device
+	Limiter    *Limiter        // Optional rate and concurrency limit for the device
+
+	auth *digestAuth
+}
+
+// DefaultClient is used by LoadServices.
+var DefaultClient = &Client{
+	Retry: DefaultRetryPolicy,
+}
+
+// NewClient creates a client with the default retry policy and a circuit breaker
+// that opens after 5 consecutive failures for 30 seconds.
+func NewClient() *Client {
+	return &Client{
+		Retry:   DefaultRetryPolicy,
+		Breaker: NewCircuitBreaker(5, 30*time.Second),
+	}
+}
+
+// SetCredentials sets the user and password for actions that require authentication.
+// This is the case for most actions of the TR-064 services.
+func (c *Client) SetCredentials(username, password string) {
+	c.auth = &digestAuth{
+		username: username,
+		password: password,
+	}
+}
+
+// Load the services tree from the igddesc.xml of an device.
+func (c *Client) LoadServices(device string, port uint16) (*Root, error) {
+	return c.LoadServicesFrom(device, port, IGDDescription)
+}
+
+// Load the services tree from several descriptions of an device.
+// A description is either a path on the device like "tr64desc.xml" or an url.
+// All services are merged into one Root. Descriptions that cannot be loaded are
+// skipped and reported in Root.Errors, an error is only returned if all fail.
+func (c *Client) LoadServicesFrom(device string, port uint16, descriptions ...string) (*Root, error) {
+	return c.loadServices(fmt.Sprintf("http://%s:%d", device, port), descriptions)
+}
+
+// Load the services tree from the description at descriptionUrl.
+// Control urls are resolved relative to the scheme and host of descriptionUrl.
+func (c *Client) LoadServicesFromUrl(descriptionUrl string) (*Root, error) {
+	u, err := url.Parse(descriptionUrl)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.loadServices(u.Scheme+"://"+u.Host, []string{descriptionUrl})
+}
+
+func (c *Client) loadServices(baseUrl string, descriptions []string) (*Root, error) {
+	if len(descriptions) == 0 {
+		return nil, errors.New("no description to load")
+	}
+
+	var root = &Root{
+		BaseUrl: baseUrl,
+		client:  c,
+	}
+
+	err := root.load(descriptions)
+	if err != nil {
+		return nil, err
+	}
+
+	return root, nil
+}
+
+// do sends a request and returns the body of the response.
+// Transient errors are retried according to the retry policy.
+// newRequest is called for every attempt because a request body can only be read once.
+func (c *Client) do(newRequest func() (*http.Request, error)) ([]byte, error) {
+	attempts := c.Retry.MaxAttempts
+	if attempts < 1 {
+		attempts = 1
+	}
+
+	var err error
+	for attempt := 0; attempt < attempts; attempt++ {
+		if attempt > 0 {
+			time.Sleep(c.Retry.Backoff(attempt - 1))
+		}
+
+		if c.Breaker != nil {
+			if err := c.Breaker.Allow(); err != nil {
+				return nil, err
+			}
+		}
+
+		var data []byte
+		data, err = c.doOnce(newRequest)
+
+		if c.Breaker != nil {
+			if IsTransient(err) {
+				c.Breaker.Failure()
+			} else {
+				c.Breaker.Success()
+			}
+		}
+
+		if !IsTransient(err) {
+			return data, err
+		}
+	}
+	return nil, err
+}
+
+func (c *Client) doOnce(newRequest func() (*http.Request, error)) ([]byte, error) {
+	req, status, data, err := c.send(newRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	if status != http.StatusOK {
+		return nil, &HTTPError{Url: req.URL.String(), StatusCode: status, Body: data}
+	}
+
+	return data, nil
+}
+
+// send sends a request and answers an authentication challenge if credentials are set.
+// The answer to the challenge is a request of its own and waits for the limiter again.
+func (c *Client) send(newRequest func() (*http.Request, error)) (*http.Request, int, []byte, error) {
+	req, status, header, data, err := c.sendOnce(newRequest)
+	if err != nil || status != http.StatusUnauthorized || c.auth == nil {
+		return req, status, data, err
+	}
+
+	challenge, ok := parseDigestChallenge(header.Get("WWW-Authenticate"))
+	if !ok {
+		return req, status, data, err
+	}
+	c.auth.setChallenge(challenge)
+
+	req, status, _, data, err = c.sendOnce(newRequest)
+	return req, status, data, err
+}
+
+func (c *Client) sendOnce(newRequest func() (*http.Request, error)) (*http.Request, int, http.Header, []byte, error) {
+	if c.Limiter != nil {
+		c.Limiter.Acquire()
+		defer c.Limiter.Release()
+	}
+
+	req, err := newRequest()
+	if err != nil {
+		return nil, 0, nil, nil, err
+	}
+
+	if c.auth != nil {
+		c.auth.authorize(req)
+	}
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = defaultHTTPClient
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, 0, nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, 0, nil, nil, err
+	}
+
+	return req, resp.StatusCode, resp.Header, data, nil
+}
+
+// get fetches a document from the device.
+func (c *Client) get(url string) ([]byte, error) {
+	return c.do(func() (*http.Request, error) {
+		return http.NewRequest("GET", url, nil)
+	})
+}
+
+// post sends a document to the device.
+func (c *Client) post(url string, header http.Header, body []byte) ([]byte, error) {
+	return c.do(func() (*http.Request, error) {
+		req, err := http.NewRequest("POST", url, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		return req, nil
+	})
+}
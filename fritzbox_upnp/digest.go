@@ -0,0 +1,155 @@
+package fritzbox_upnp
+
+// Copyright 2016 Nils Decker
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// Most TR-064 actions require HTTP digest authentication (RFC 2617)
+// with the credentials of a user of the box.
+
+// A digest challenge sent by the device in the WWW-Authenticate header
+type digestChallenge struct {
+	realm     string
+	nonce     string
+	opaque    string
+	algorithm string
+	qop       string
+}
+
+func parseDigestChallenge(header string) (*digestChallenge, bool) {
+	if !strings.HasPrefix(header, "Digest ") {
+		return nil, false
+	}
+
+	c := &digestChallenge{}
+	for _, part := range splitDigestParams(strings.TrimPrefix(header, "Digest ")) {
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+
+		val := strings.Trim(strings.TrimSpace(kv[1]), `"`)
+		switch strings.ToLower(strings.TrimSpace(kv[0])) {
+		case "realm":
+			c.realm = val
+		case "nonce":
+			c.nonce = val
+		case "opaque":
+			c.opaque = val
+		case "algorithm":
+			c.algorithm = val
+		case "qop":
+			// the device may offer several qop values, only "auth" is supported
+			for _, q := range strings.Split(val, ",") {
+				if strings.TrimSpace(q) == "auth" {
+					c.qop = "auth"
+				}
+			}
+		}
+	}
+	return c, c.nonce != ""
+}
+
+// splitDigestParams splits the parameters of a challenge at commas outside of quotes.
+func splitDigestParams(s string) []string {
+	var res []string
+	quoted := false
+	start := 0
+	for i, r := range s {
+		switch {
+		case r == '"':
+			quoted = !quoted
+		case r == ',' && !quoted:
+			res = append(res, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(res, s[start:])
+}
+
+// digestAuth keeps the last challenge of a device so that requests can be
+// authorized without an additional round trip.
+type digestAuth struct {
+	username string
+	password string
+
+	mu        sync.Mutex
+	challenge *digestChallenge
+	count     int
+}
+
+func (d *digestAuth) setChallenge(c *digestChallenge) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.challenge = c
+	d.count = 0
+}
+
+// authorize adds the Authorization header to req if a challenge is known.
+func (d *digestAuth) authorize(req *http.Request) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	c := d.challenge
+	if c == nil {
+		return
+	}
+	d.count++
+
+	uri := req.URL.RequestURI()
+	ha1 := md5hex(fmt.Sprintf("%s:%s:%s", d.username, c.realm, d.password))
+	ha2 := md5hex(fmt.Sprintf("%s:%s", req.Method, uri))
+
+	var auth string
+	if c.qop == "" {
+		response := md5hex(fmt.Sprintf("%s:%s:%s", ha1, c.nonce, ha2))
+		auth = fmt.Sprintf(`Digest username="%s", realm="%s", nonce="%s", uri="%s", response="%s"`,
+			d.username, c.realm, c.nonce, uri, response)
+	} else {
+		nc := fmt.Sprintf("%08x", d.count)
+		cnonce := newCnonce()
+		response := md5hex(fmt.Sprintf("%s:%s:%s:%s:%s:%s", ha1, c.nonce, nc, cnonce, c.qop, ha2))
+		auth = fmt.Sprintf(`Digest username="%s", realm="%s", nonce="%s", uri="%s", qop=%s, nc=%s, cnonce="%s", response="%s"`,
+			d.username, c.realm, c.nonce, uri, c.qop, nc, cnonce, response)
+	}
+
+	if c.algorithm != "" {
+		auth += fmt.Sprintf(", algorithm=%s", c.algorithm)
+	}
+	if c.opaque != "" {
+		auth += fmt.Sprintf(`, opaque="%s"`, c.opaque)
+	}
+	req.Header.Set("Authorization", auth)
+}
+
+func md5hex(s string) string {
+	sum := md5.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func newCnonce() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,104 @@
+package fritzbox_upnp
+
+// Copyright 2016 Nils Decker
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"sync"
+	"time"
+)
+
+// A Limiter restricts the requests sent to a device. It combines a token bucket
+// for the request rate with a maximum number of concurrent requests.
+type Limiter struct {
+	// Observe is called with the time every request waited in the limiter.
+	Observe func(wait time.Duration)
+
+	rate  float64 // tokens per second, <= 0 means unlimited
+	burst float64
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+
+	slots chan struct{} // nil means unlimited
+}
+
+// NewLimiter creates a limiter that allows requestsPerSecond requests with bursts
+// of up to burst requests and at most maxConcurrent requests at the same time.
+// Values <= 0 disable the respective limit.
+func NewLimiter(requestsPerSecond float64, burst int, maxConcurrent int) *Limiter {
+	if burst < 1 {
+		burst = 1
+	}
+
+	l := &Limiter{
+		rate:   requestsPerSecond,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+
+	if maxConcurrent > 0 {
+		l.slots = make(chan struct{}, maxConcurrent)
+	}
+	return l
+}
+
+// Acquire blocks until a request may be sent. Every call has to be followed by Release.
+func (l *Limiter) Acquire() {
+	start := time.Now()
+
+	if l.slots != nil {
+		l.slots <- struct{}{}
+	}
+
+	if wait := l.reserve(); wait > 0 {
+		time.Sleep(wait)
+	}
+
+	if l.Observe != nil {
+		l.Observe(time.Since(start))
+	}
+}
+
+// Release frees the concurrency slot taken by Acquire.
+func (l *Limiter) Release() {
+	if l.slots != nil {
+		<-l.slots
+	}
+}
+
+// reserve takes a token from the bucket and returns how long to wait until it is available.
+func (l *Limiter) reserve() time.Duration {
+	if l.rate <= 0 {
+		return 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+
+	l.tokens--
+	if l.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-l.tokens / l.rate * float64(time.Second))
+}
@@ -0,0 +1,120 @@
+package fritzbox_upnp
+
+// Copyright 2016 Nils Decker
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"math/rand"
+	"net"
+	"net/http"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// A RetryPolicy describes how often and how fast failed requests are retried.
+type RetryPolicy struct {
+	MaxAttempts    int           // Number of attempts including the first one. Values < 1 mean a single attempt.
+	InitialBackoff time.Duration // Wait time before the first retry
+	MaxBackoff     time.Duration // Upper limit of the wait time between retries
+	Multiplier     float64       // Growth of the wait time per attempt
+	Jitter         float64       // Fraction of the wait time that is randomized (0 - 1)
+}
+
+// DefaultRetryPolicy is used by clients without an explicit policy.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    3,
+	InitialBackoff: 500 * time.Millisecond,
+	MaxBackoff:     1 * time.Minute,
+	Multiplier:     2,
+	Jitter:         0.2,
+}
+
+// Upper limit of the wait time of policies without MaxBackoff, leaving room
+// for the jitter before a time.Duration overflows.
+const maxBackoff = math.MaxInt64 / 4
+
+// Backoff returns the time to wait before retry number attempt (starting at 0).
+func (p RetryPolicy) Backoff(attempt int) time.Duration {
+	if p.InitialBackoff <= 0 {
+		return 0
+	}
+
+	multiplier := p.Multiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+
+	backoff := float64(p.InitialBackoff) * math.Pow(multiplier, float64(attempt))
+	if p.MaxBackoff > 0 && backoff > float64(p.MaxBackoff) {
+		backoff = float64(p.MaxBackoff)
+	}
+	if backoff > maxBackoff {
+		backoff = maxBackoff
+	}
+
+	if p.Jitter > 0 {
+		jitter := math.Min(p.Jitter, 1)
+		backoff = backoff * (1 - jitter + 2*jitter*rand.Float64())
+	}
+
+	return time.Duration(backoff)
+}
+
+// An HTTPError is returned if the device answers with an unexpected status code.
+type HTTPError struct {
+	Url        string
+	StatusCode int
+	Body       []byte
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("%s: unexpected status %d %s", e.Url, e.StatusCode, http.StatusText(e.StatusCode))
+}
+
+// IsTransient returns if err is worth retrying: connection resets, timeouts
+// and the status codes 500 and 503 that a busy or rebooting device answers with.
+// A status 500 carrying a UPnP error is the definite answer to an action and not transient.
+func IsTransient(err error) bool {
+	switch e := err.(type) {
+	case nil:
+		return false
+	case *SOAPError:
+		return false
+	case *HTTPError:
+		if e.StatusCode == http.StatusInternalServerError && bytes.Contains(e.Body, []byte("UPnPError")) {
+			return false
+		}
+		return e.StatusCode == http.StatusInternalServerError ||
+			e.StatusCode == http.StatusServiceUnavailable
+	case net.Error:
+		if e.Timeout() {
+			return true
+		}
+	}
+
+	if err == syscall.ECONNRESET || err == syscall.ECONNREFUSED {
+		return true
+	}
+
+	// the errors of the net package are wrapped several times, depending on
+	// where the connection failed.
+	msg := err.Error()
+	return strings.Contains(msg, "connection reset") ||
+		strings.Contains(msg, "connection refused") ||
+		strings.HasSuffix(msg, "EOF")
+}
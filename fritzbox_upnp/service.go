@@ -22,6 +22,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
 )
@@ -35,13 +36,56 @@ import (
 
 const text_xml = `text/xml; charset="utf-8"`
 
-var ErrInvalidSOAPResponse = errors.New("invalid SOAP response")
+var (
+	ErrInvalidSOAPResponse = errors.New("invalid SOAP response")
+	ErrServiceNotFound     = errors.New("service not found")
+	ErrActionNotFound      = errors.New("action not found")
+)
+
+// A SOAPError is returned if the device rejects an action with an UPnP error.
+type SOAPError struct {
+	Code        int
+	Description string
+}
+
+func (e *SOAPError) Error() string {
+	return fmt.Sprintf("UPnP error %d: %s", e.Code, e.Description)
+}
+
+// UPnP error codes used by the Fritz!Box
+const (
+	UPnPErrorInvalidArgs       = 402
+	UPnPErrorActionFailed      = 501
+	UPnPErrorSpecifiedArrayIdx = 713 // Index out of range
+	UPnPErrorNoSuchEntry       = 714
+)
+
+type soapFault struct {
+	Code        int    `xml:"Body>Fault>detail>UPnPError>errorCode"`
+	Description string `xml:"Body>Fault>detail>UPnPError>errorDescription"`
+}
+
+// The description documents published by Fritz!Box devices
+const (
+	IGDDescription    = "igddesc.xml"
+	TR64Description   = "tr64desc.xml"
+	AnyDescription    = "any.xml"
+	L2TPv3Description = "l2tpv3.xml"
+)
 
 // Root of the UPNP tree
 type Root struct {
-	BaseUrl  string
-	Device   Device `xml:"device"`
-	Services map[string]*Service // Map of all services indexed by .ServiceType
+	BaseUrl  string              // Descriptions and documents given as path are loaded from here
+	Device   Device              // Root device of the first description
+	Devices  []*Device           // Root devices of all loaded descriptions
+	Services map[string]*Service // Map of all services of all descriptions indexed by .ServiceType
+	Errors   []error             // Errors of the descriptions that could not be loaded
+
+	client *Client
+}
+
+type descriptionRoot struct {
+	Device *Device `xml:"device"`
 }
 
 // An UPNP Device
@@ -66,7 +110,8 @@ type Device struct {
 
 // An UPNP Service
 type Service struct {
-	Device *Device
+	Device     *Device
+	controlUrl string // ControlUrl resolved against the description
 
 	ServiceType string `xml:"serviceType"`
 	ServiceId   string `xml:"serviceId"`
@@ -75,7 +120,7 @@ type Service struct {
 	SCPDUrl     string `xml:"SCPDURL"`
 
 	Actions        map[string]*Action // All actions available on the service
-	StateVariables []*StateVariable // All state variables available on the service
+	StateVariables []*StateVariable   // All state variables available on the service
 }
 
 type scpdRoot struct {
@@ -87,8 +132,8 @@ type scpdRoot struct {
 type Action struct {
 	service *Service
 
-	Name        string      `xml:"name"`
-	Arguments   []*Argument `xml:"argumentList>argument"`
+	Name        string               `xml:"name"`
+	Arguments   []*Argument          `xml:"argumentList>argument"`
 	ArgumentMap map[string]*Argument // Map of arguments indexed by .Name
 }
 
@@ -120,46 +165,148 @@ type StateVariable struct {
 
 // The result of a Call() contains all output arguments of the call.
 // The map is indexed by the name of the state variable.
-// The type of the value is string, uint64 or bool depending of the DataType of the variable.
+// The type of the value is string, uint64, int64 or bool depending of the DataType of the variable.
 type Result map[string]interface{}
 
-// load the whole tree
-func (r *Root) load() error {
-	igddesc, err := http.Get(
-		fmt.Sprintf("%s/igddesc.xml", r.BaseUrl),
-	)
+// GetString returns a value as string. Numbers and booleans are formatted.
+func (r Result) GetString(name string) string {
+	switch val := r[name].(type) {
+	case nil:
+		return ""
+	case string:
+		return val
+	case bool:
+		if val {
+			return "1"
+		}
+		return "0"
+	default:
+		return fmt.Sprint(val)
+	}
+}
+
+// GetFloat returns a numeric or boolean value as float64.
+// ok is false if the value is missing or a string that is no number.
+func (r Result) GetFloat(name string) (res float64, ok bool) {
+	switch val := r[name].(type) {
+	case uint64:
+		return float64(val), true
+	case int64:
+		return float64(val), true
+	case bool:
+		if val {
+			return 1, true
+		}
+		return 0, true
+	case string:
+		f, err := strconv.ParseFloat(val, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
 
+// GetBool returns if a value is true, "1" or a number different from 0.
+func (r Result) GetBool(name string) bool {
+	f, ok := r.GetFloat(name)
+	return ok && f != 0
+}
+
+// load the whole tree from one or more description documents. A description
+// that cannot be loaded is skipped and its error kept in r.Errors, load only
+// fails if no description can be loaded.
+func (r *Root) load(descriptions []string) error {
+	r.Services = make(map[string]*Service)
+
+	for _, description := range descriptions {
+		err := r.loadDescription(description)
+		if err != nil {
+			r.Errors = append(r.Errors, err)
+		}
+	}
+
+	if len(r.Devices) == 0 {
+		return r.Errors[0]
+	}
+	return nil
+}
+
+// loadDescription adds the services of one description document. The services
+// are only added if all of them could be loaded.
+func (r *Root) loadDescription(description string) error {
+	baseUrl, err := url.Parse(r.descriptionUrl(description))
 	if err != nil {
 		return err
 	}
 
-	dec := xml.NewDecoder(igddesc.Body)
+	data, err := r.client.get(baseUrl.String())
+	if err != nil {
+		return err
+	}
 
-	err = dec.Decode(r)
+	var desc descriptionRoot
+	err = xml.Unmarshal(data, &desc)
+	if err != nil {
+		return fmt.Errorf("%s: %s", description, err)
+	}
+
+	if desc.Device == nil {
+		return fmt.Errorf("%s: no device found", description)
+	}
+
+	device := desc.Device
+	if len(r.Devices) == 0 {
+		r.Device = *desc.Device
+		device = &r.Device
+	}
+
+	services := make(map[string]*Service)
+	err = device.fillServices(r, baseUrl, services)
 	if err != nil {
 		return err
 	}
 
-	r.Services = make(map[string]*Service)
-	return r.Device.fillServices(r)
+	r.Devices = append(r.Devices, device)
+	for t, s := range services {
+		r.Services[t] = s
+	}
+	return nil
 }
 
-// load all service descriptions
-func (d *Device) fillServices(r *Root) error {
+// descriptionUrl returns the url of a description given as url or as path on the device.
+func (r *Root) descriptionUrl(description string) string {
+	if strings.HasPrefix(description, "http://") || strings.HasPrefix(description, "https://") {
+		return description
+	}
+	return r.BaseUrl + "/" + strings.TrimPrefix(description, "/")
+}
+
+// load all service descriptions. The urls of the services are resolved
+// against the url of the description, so services of descriptions from
+// different hosts are called on their own host.
+func (d *Device) fillServices(r *Root, baseUrl *url.URL, services map[string]*Service) error {
 	d.root = r
 
 	for _, s := range d.Services {
 		s.Device = d
 
-		response, err := http.Get(r.BaseUrl + s.SCPDUrl)
+		scpdUrl, err := baseUrl.Parse(s.SCPDUrl)
+		if err != nil {
+			return err
+		}
+		controlUrl, err := baseUrl.Parse(s.ControlUrl)
+		if err != nil {
+			return err
+		}
+		s.controlUrl = controlUrl.String()
+
+		response, err := r.client.get(scpdUrl.String())
 		if err != nil {
 			return err
 		}
 
 		var scpd scpdRoot
 
-		dec := xml.NewDecoder(response.Body)
-		err = dec.Decode(&scpd)
+		err = xml.Unmarshal(response, &scpd)
 		if err != nil {
 			return err
 		}
@@ -185,10 +332,10 @@ func (d *Device) fillServices(r *Root) error {
 			}
 		}
 
-		r.Services[s.ServiceType] = s
+		services[s.ServiceType] = s
 	}
 	for _, d2 := range d.Devices {
-		err := d2.fillServices(r)
+		err := d2.fillServices(r, baseUrl, services)
 		if err != nil {
 			return err
 		}
@@ -196,42 +343,84 @@ func (d *Device) fillServices(r *Root) error {
 	return nil
 }
 
-// Call an action.
-// Currently only actions without input arguments are supported.
-func (a *Action) Call() (Result, error) {
+// An input argument of an action call
+type ActionArgument struct {
+	Name  string
+	Value interface{}
+}
+
+// Call an action with the given input arguments.
+func (a *Action) Call(args ...ActionArgument) (Result, error) {
+	var argstr bytes.Buffer
+	for _, arg := range args {
+		fmt.Fprintf(&argstr, "<%s>", arg.Name)
+		xml.EscapeText(&argstr, []byte(fmt.Sprint(arg.Value)))
+		fmt.Fprintf(&argstr, "</%s>", arg.Name)
+	}
+
 	bodystr := fmt.Sprintf(`
         <?xml version='1.0' encoding='utf-8'?> 
         <s:Envelope s:encodingStyle='http://schemas.xmlsoap.org/soap/encoding/' xmlns:s='http://schemas.xmlsoap.org/soap/envelope/'> 
             <s:Body> 
-                <u:%s xmlns:u='%s' /> 
+                <u:%s xmlns:u='%s'>%s</u:%s>
             </s:Body>
         </s:Envelope>
-    `, a.Name, a.service.ServiceType)
-
-	url := a.service.Device.root.BaseUrl + a.service.ControlUrl
-	body := strings.NewReader(bodystr)
+    `, a.Name, a.service.ServiceType, argstr.String(), a.Name)
 
-	req, err := http.NewRequest("POST", url, body)
-	if err != nil {
-		return nil, err
-	}
+	root := a.service.Device.root
+	url := a.service.controlUrl
 
 	action := fmt.Sprintf("%s#%s", a.service.ServiceType, a.Name)
 
-	req.Header["Content-Type"] = []string{text_xml}
-	req.Header["SoapAction"] = []string{action}
+	header := make(http.Header)
+	header["Content-Type"] = []string{text_xml}
+	header["SoapAction"] = []string{action}
 
-	resp, err := http.DefaultClient.Do(req)
+	data, err := root.client.post(url, header, []byte(bodystr))
 	if err != nil {
+		if herr, ok := err.(*HTTPError); ok {
+			var fault soapFault
+			if xml.Unmarshal(herr.Body, &fault) == nil && fault.Code != 0 {
+				return nil, &SOAPError{Code: fault.Code, Description: fault.Description}
+			}
+		}
 		return nil, err
 	}
 
-	data := new(bytes.Buffer)
-	data.ReadFrom(resp.Body)
+	// fmt.Printf(string(data))
+	return a.parseSoapResponse(bytes.NewReader(data))
 
-	// fmt.Printf(data.String())
-	return a.parseSoapResponse(data)
+}
+
+// Call an action of a service. Returns ErrServiceNotFound or ErrActionNotFound
+// if the device does not offer the action.
+func (r *Root) Call(serviceType, actionName string, args ...ActionArgument) (Result, error) {
+	service, ok := r.Services[serviceType]
+	if !ok {
+		return nil, ErrServiceNotFound
+	}
+	action, ok := service.Actions[actionName]
+	if !ok {
+		return nil, ErrActionNotFound
+	}
+	return action.Call(args...)
+}
+
+// HasAction returns if the device offers the action.
+func (r *Root) HasAction(serviceType, actionName string) bool {
+	service, ok := r.Services[serviceType]
+	if !ok {
+		return false
+	}
+	_, ok = service.Actions[actionName]
+	return ok
+}
 
+// Fetch gets a document from the device. Some actions return the path
+// of a document instead of the data itself, e.g. X_AVM-DE_GetHostListPath.
+// path may be an url or a path relative to BaseUrl.
+func (r *Root) Fetch(path string) ([]byte, error) {
+	return r.client.get(r.descriptionUrl(path))
 }
 
 func (a *Action) parseSoapResponse(r io.Reader) (Result, error) {
@@ -285,29 +474,38 @@ func convertResult(val string, arg *Argument) (interface{}, error) {
 	case "boolean":
 		return bool(val == "1"), nil
 
-	case "ui1", "ui2", "ui4":
+	case "ui1", "ui2", "ui4", "ui8":
 		// type ui4 can contain values greater than 2^32!
 		res, err := strconv.ParseUint(val, 10, 64)
 		if err != nil {
 			return nil, err
 		}
 		return uint64(res), nil
+	case "i1", "i2", "i4", "i8":
+		res, err := strconv.ParseInt(val, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		return int64(res), nil
+	case "dateTime", "uuid", "bin.base64":
+		return val, nil
 	default:
 		return nil, fmt.Errorf("unknown datatype: %s", arg.StateVariable.DataType)
 
 	}
 }
 
-// Load the services tree from an device.
+// Load the services tree from an device using the DefaultClient.
 func LoadServices(device string, port uint16) (*Root, error) {
-	var root = &Root{
-		BaseUrl: fmt.Sprintf("http://%s:%d", device, port),
-	}
+	return DefaultClient.LoadServices(device, port)
+}
 
-	err := root.load()
-	if err != nil {
-		return nil, err
-	}
+// Load the services tree from the given descriptions of a device using the DefaultClient.
+func LoadServicesFrom(device string, port uint16, descriptions ...string) (*Root, error) {
+	return DefaultClient.LoadServicesFrom(device, port, descriptions...)
+}
 
-	return root, nil
+// Load the services tree from a description url using the DefaultClient.
+func LoadServicesFromUrl(descriptionUrl string) (*Root, error) {
+	return DefaultClient.LoadServicesFromUrl(descriptionUrl)
 }
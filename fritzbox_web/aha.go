@@ -0,0 +1,120 @@
+package fritzbox_web
+
+// Copyright 2016 Nils Decker
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"encoding/xml"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// The AHA-HTTP interface is documented in
+// https://avm.de/fileadmin/user_upload/Global/Service/Schnittstellen/AHA-HTTP-Interface.pdf
+
+const ahaPath = "/webservices/homeautoswitch.lua"
+
+// Special values of thermostat temperatures
+const (
+	ahaTemperatureOff = 253
+	ahaTemperatureOn  = 254
+)
+
+// A smart home device as returned by getdevicelistinfos.
+// Optional parts are nil if the device does not support them.
+type AHADevice struct {
+	AIN             string `xml:"identifier,attr"`
+	ID              string `xml:"id,attr"`
+	FunctionBitmask int    `xml:"functionbitmask,attr"`
+	FirmwareVersion string `xml:"fwversion,attr"`
+	Manufacturer    string `xml:"manufacturer,attr"`
+	ProductName     string `xml:"productname,attr"`
+
+	Present    string `xml:"present"`
+	Name       string `xml:"name"`
+	Battery    string `xml:"battery"`    // Percent
+	BatteryLow string `xml:"batterylow"` // 1 if the battery is low
+
+	Switch      *AHASwitch      `xml:"switch"`
+	PowerMeter  *AHAPowerMeter  `xml:"powermeter"`
+	Temperature *AHATemperature `xml:"temperature"`
+	Thermostat  *AHAThermostat  `xml:"hkr"`
+}
+
+type AHASwitch struct {
+	State string `xml:"state"` // 1 = on, 0 = off, empty if unknown
+	Mode  string `xml:"mode"`
+	Lock  string `xml:"lock"`
+}
+
+type AHAPowerMeter struct {
+	Voltage string `xml:"voltage"` // mV
+	Power   string `xml:"power"`   // mW
+	Energy  string `xml:"energy"`  // Wh
+}
+
+type AHATemperature struct {
+	Celsius string `xml:"celsius"` // 0.1 °C
+	Offset  string `xml:"offset"`  // 0.1 °C
+}
+
+// Temperatures of a thermostat are given in steps of 0.5 °C
+type AHAThermostat struct {
+	Actual     string `xml:"tist"`
+	Target     string `xml:"tsoll"`
+	Eco        string `xml:"absenk"`
+	Comfort    string `xml:"komfort"`
+	WindowOpen string `xml:"windowopenactiv"`
+	ErrorCode  string `xml:"errorcode"`
+}
+
+type ahaDeviceList struct {
+	Devices []*AHADevice `xml:"device"`
+}
+
+// AHADeviceList returns all smart home devices known to the box.
+func (s *Session) AHADeviceList() ([]*AHADevice, error) {
+	data, err := s.Get(ahaPath, url.Values{"switchcmd": {"getdevicelistinfos"}})
+	if err != nil {
+		return nil, err
+	}
+
+	var list ahaDeviceList
+	err = xml.Unmarshal(data, &list)
+	if err != nil {
+		return nil, err
+	}
+	return list.Devices, nil
+}
+
+// AHAValue parses a numeric value of the AHA interface and scales it by factor.
+// ok is false if the value is missing.
+func AHAValue(val string, factor float64) (res float64, ok bool) {
+	f, err := strconv.ParseFloat(strings.TrimSpace(val), 64)
+	if err != nil {
+		return 0, false
+	}
+	return f * factor, true
+}
+
+// AHAThermostatValue parses a thermostat temperature in °C.
+// ok is false if the value is missing or the thermostat is switched permanently on or off.
+func AHAThermostatValue(val string) (res float64, ok bool) {
+	f, ok := AHAValue(val, 1)
+	if !ok || f == ahaTemperatureOff || f == ahaTemperatureOn {
+		return 0, false
+	}
+	return f / 2, true
+}
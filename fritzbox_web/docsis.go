@@ -0,0 +1,63 @@
+package fritzbox_web
+
+// Copyright 2016 Nils Decker
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"encoding/json"
+)
+
+// The channel information of the DOCSIS page of cable models (Internet > Cable Information)
+type DocsisInfo struct {
+	Downstream DocsisChannels `json:"channelDs"`
+	Upstream   DocsisChannels `json:"channelUs"`
+}
+
+// Channels by DOCSIS version
+type DocsisChannels struct {
+	Docsis30 []*DocsisChannel `json:"docsis30"`
+	Docsis31 []*DocsisChannel `json:"docsis31"`
+}
+
+// A DOCSIS channel. Depending on version and direction not all values are set.
+type DocsisChannel struct {
+	ChannelID      Value `json:"channelID"`
+	Frequency      Value `json:"frequency"`  // MHz, a range for OFDM(A) channels
+	Modulation     Value `json:"type"`       // e.g. 256QAM, 4K, OFDMA
+	PowerLevel     Value `json:"powerLevel"` // dBmV
+	MSE            Value `json:"mse"`        // dB, DOCSIS 3.0 downstream
+	MER            Value `json:"mer"`        // dB, DOCSIS 3.1 downstream
+	Multiplex      Value `json:"multiplex"`
+	CorrErrors     Value `json:"corrErrors"`
+	NonCorrErrors  Value `json:"nonCorrErrors"`
+	Latency        Value `json:"latency"`
+	ActiveSubcarrs Value `json:"activesub"`
+}
+
+// DocsisInfo returns the channels of the cable connection.
+func (s *Session) DocsisInfo() (*DocsisInfo, error) {
+	data, err := s.Data("docInfo", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var res struct {
+		Data DocsisInfo `json:"data"`
+	}
+	err = json.Unmarshal(data, &res)
+	if err != nil {
+		return nil, err
+	}
+	return &res.Data, nil
+}
@@ -0,0 +1,95 @@
+package fritzbox_web
+
+// Copyright 2016 Nils Decker
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"encoding/json"
+)
+
+// The current system load (System > Energy Monitor > Statistics). Missing
+// values are empty.
+type EcoStat struct {
+	CPUTemperature Value // °C
+	CPULoad        Value // percent
+	RAMFixed       Value // percent used by the system
+	RAMDynamic     Value // percent used by applications
+	RAMFree        Value // percent
+}
+
+// A subsystem of the energy monitor (System > Energy Monitor)
+type EnergyConsumer struct {
+	Name    Value `json:"name"`    // e.g. Total system, WLAN, DSL, USB, LAN
+	Percent Value `json:"actPerc"` // current consumption in percent of the maximum
+}
+
+// The values of a chart of the ecoStat page, oldest first
+type ecoSeries struct {
+	Series [][]Value `json:"series"`
+}
+
+// last returns the newest value of series i.
+func (s *ecoSeries) last(i int) Value {
+	if i >= len(s.Series) || len(s.Series[i]) == 0 {
+		return ""
+	}
+	return s.Series[i][len(s.Series[i])-1]
+}
+
+// EcoStat returns the current CPU and memory load.
+func (s *Session) EcoStat() (*EcoStat, error) {
+	data, err := s.Data("ecoStat", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var res struct {
+		Data struct {
+			CPUTemp  ecoSeries `json:"cputemp"`
+			CPUUtil  ecoSeries `json:"cpuutil"`
+			RAMUsage ecoSeries `json:"ramusage"` // fixed, dynamic, free
+		} `json:"data"`
+	}
+	err = json.Unmarshal(data, &res)
+	if err != nil {
+		return nil, err
+	}
+
+	return &EcoStat{
+		CPUTemperature: res.Data.CPUTemp.last(0),
+		CPULoad:        res.Data.CPUUtil.last(0),
+		RAMFixed:       res.Data.RAMUsage.last(0),
+		RAMDynamic:     res.Data.RAMUsage.last(1),
+		RAMFree:        res.Data.RAMUsage.last(2),
+	}, nil
+}
+
+// EnergyUsage returns the current power consumption of the subsystems.
+func (s *Session) EnergyUsage() ([]*EnergyConsumer, error) {
+	data, err := s.Data("energy", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var res struct {
+		Data struct {
+			Drain []*EnergyConsumer `json:"drain"`
+		} `json:"data"`
+	}
+	err = json.Unmarshal(data, &res)
+	if err != nil {
+		return nil, err
+	}
+	return res.Data.Drain, nil
+}
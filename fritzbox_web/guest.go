@@ -0,0 +1,43 @@
+package fritzbox_web
+
+// Copyright 2016 Nils Decker
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"encoding/json"
+)
+
+// The guest access settings (Home Network > Wi-Fi > Guest Access). The guest
+// LAN port is not available by TR-064.
+type GuestAccess struct {
+	WLANEnabled Value `json:"guestWlanActive"`
+	LANEnabled  Value `json:"guestLanActive"` // LAN 4 is used as guest port
+}
+
+// GuestAccess returns the guest access settings.
+func (s *Session) GuestAccess() (*GuestAccess, error) {
+	data, err := s.Data("wGuest", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var res struct {
+		Data GuestAccess `json:"data"`
+	}
+	err = json.Unmarshal(data, &res)
+	if err != nil {
+		return nil, err
+	}
+	return &res.Data, nil
+}
@@ -0,0 +1,90 @@
+package fritzbox_web
+
+// Copyright 2016 Nils Decker
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"encoding/json"
+	"net/url"
+)
+
+// The periods of the online monitor, as named by inetstat
+var TrafficPeriods = []string{"Today", "Yesterday", "ThisWeek", "ThisMonth", "LastMonth"}
+
+// Traffic totals of a period of the online monitor (Internet > Online Monitor > Online Counter)
+type TrafficCounter struct {
+	Period        string
+	BytesSent     float64
+	BytesReceived float64
+	OnlineTime    float64 // seconds
+	Connections   float64
+}
+
+// TrafficHistory returns the traffic totals of the periods of the online
+// monitor. Periods without values are left out.
+func (s *Session) TrafficHistory() ([]*TrafficCounter, error) {
+	vars := []string{"BytesSentHigh", "BytesSentLow", "BytesReceivedHigh", "BytesReceivedLow",
+		"PhyConnTimeOutgoing", "OutgoingCalls"}
+
+	params := url.Values{}
+	for _, p := range TrafficPeriods {
+		for _, v := range vars {
+			params.Set(p+v, "inetstat:status/"+p+"/"+v)
+		}
+	}
+
+	data, err := s.Query(params)
+	if err != nil {
+		return nil, err
+	}
+
+	var res map[string]Value
+	err = json.Unmarshal(data, &res)
+	if err != nil {
+		return nil, err
+	}
+
+	var counters []*TrafficCounter
+	for _, p := range TrafficPeriods {
+		sent, ok := bytes64(res[p+"BytesSentHigh"], res[p+"BytesSentLow"])
+		if !ok {
+			continue
+		}
+		received, _ := bytes64(res[p+"BytesReceivedHigh"], res[p+"BytesReceivedLow"])
+		online, _ := res[p+"PhyConnTimeOutgoing"].Float()
+		connections, _ := res[p+"OutgoingCalls"].Float()
+
+		counters = append(counters, &TrafficCounter{
+			Period:        p,
+			BytesSent:     sent,
+			BytesReceived: received,
+			OnlineTime:    online,
+			Connections:   connections,
+		})
+	}
+	return counters, nil
+}
+
+// bytes64 joins the two 32 bit halves of a byte counter.
+func bytes64(high, low Value) (float64, bool) {
+	h, ok := high.Float()
+	if !ok {
+		return 0, false
+	}
+	l, ok := low.Float()
+	if !ok {
+		return 0, false
+	}
+	return h*4294967296 + l, true
+}
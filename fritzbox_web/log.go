@@ -0,0 +1,71 @@
+package fritzbox_web
+
+// Copyright 2016 Nils Decker
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/url"
+)
+
+// An entry of the event log (System > Event Log)
+type LogEntry struct {
+	Date    Value `json:"date"` // dd.mm.yy
+	Time    Value `json:"time"` // hh:mm:ss
+	Message Value `json:"msg"`
+	ID      Value `json:"id"`    // Message ID
+	Group   Value `json:"group"` // e.g. sys, net, fon, wlan, usb
+}
+
+// Older firmware sends an entry as array [date, time, msg, id, group, help url].
+func (e *LogEntry) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+
+	if len(data) > 0 && data[0] == '[' {
+		var fields []Value
+		err := json.Unmarshal(data, &fields)
+		if err != nil {
+			return err
+		}
+
+		dest := []*Value{&e.Date, &e.Time, &e.Message, &e.ID, &e.Group}
+		for i := 0; i < len(fields) && i < len(dest); i++ {
+			*dest[i] = fields[i]
+		}
+		return nil
+	}
+
+	type entry LogEntry
+	return json.Unmarshal(data, (*entry)(e))
+}
+
+// Log returns all entries of the event log, newest first.
+func (s *Session) Log() ([]*LogEntry, error) {
+	data, err := s.Data("log", url.Values{"filter": {"0"}})
+	if err != nil {
+		return nil, err
+	}
+
+	var res struct {
+		Data struct {
+			Log []*LogEntry `json:"log"`
+		} `json:"data"`
+	}
+	err = json.Unmarshal(data, &res)
+	if err != nil {
+		return nil, err
+	}
+	return res.Data.Log, nil
+}
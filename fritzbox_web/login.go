@@ -0,0 +1,145 @@
+package fritzbox_web
+
+// Copyright 2016 Nils Decker
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// AVM documents the login procedure in
+// https://avm.de/fileadmin/user_upload/Global/Service/Schnittstellen/AVM_Technical_Note_-_Session_ID_english_2021-05-03.pdf
+
+// The SID of an invalid session
+const invalidSID = "0000000000000000"
+
+// The answer of login_sid.lua
+type sessionInfo struct {
+	SID       string `xml:"SID"`
+	Challenge string `xml:"Challenge"`
+	BlockTime int    `xml:"BlockTime"`
+	Users     []struct {
+		Name string `xml:",chardata"`
+		Last string `xml:"last,attr"`
+	} `xml:"Users>User"`
+}
+
+// lastUser returns the user that logged in last. The box preselects this user
+// in the login form.
+func (si *sessionInfo) lastUser() string {
+	for _, u := range si.Users {
+		if u.Last == "1" {
+			return u.Name
+		}
+	}
+	return ""
+}
+
+// challengeResponse calculates the response to a login challenge. Challenges starting
+// with "2$" use the PBKDF2 scheme of Fritz!OS 7.24 and later, all other challenges
+// the legacy MD5 scheme.
+func challengeResponse(challenge, password string) (string, error) {
+	if strings.HasPrefix(challenge, "2$") {
+		return pbkdf2Response(challenge, password)
+	}
+	return md5Response(challenge, password), nil
+}
+
+// pbkdf2Response solves a challenge of the form 2$<iter1>$<salt1>$<iter2>$<salt2>.
+func pbkdf2Response(challenge, password string) (string, error) {
+	parts := strings.Split(challenge, "$")
+	if len(parts) != 5 {
+		return "", fmt.Errorf("invalid challenge: %s", challenge)
+	}
+
+	iter1, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return "", fmt.Errorf("invalid challenge: %s", challenge)
+	}
+	salt1, err := hex.DecodeString(parts[2])
+	if err != nil {
+		return "", fmt.Errorf("invalid challenge: %s", challenge)
+	}
+	iter2, err := strconv.Atoi(parts[3])
+	if err != nil {
+		return "", fmt.Errorf("invalid challenge: %s", challenge)
+	}
+	salt2, err := hex.DecodeString(parts[4])
+	if err != nil {
+		return "", fmt.Errorf("invalid challenge: %s", challenge)
+	}
+
+	hash1 := pbkdf2([]byte(password), salt1, iter1, sha256.Size, sha256.New)
+	hash2 := pbkdf2(hash1, salt2, iter2, sha256.Size, sha256.New)
+
+	return fmt.Sprintf("%s$%s", parts[4], hex.EncodeToString(hash2)), nil
+}
+
+// md5Response solves a legacy challenge. The hash is calculated over the UTF-16LE
+// encoding of "<challenge>-<password>", characters above U+00FF are replaced by a dot.
+func md5Response(challenge, password string) string {
+	var runes []rune
+	for _, r := range challenge + "-" + password {
+		if r > 0xff {
+			r = '.'
+		}
+		runes = append(runes, r)
+	}
+
+	h := md5.New()
+	for _, c := range utf16.Encode(runes) {
+		binary.Write(h, binary.LittleEndian, c)
+	}
+
+	return fmt.Sprintf("%s-%s", challenge, hex.EncodeToString(h.Sum(nil)))
+}
+
+// pbkdf2 derives a key as described in RFC 8018, section 5.2.
+func pbkdf2(password, salt []byte, iterations, keyLen int, h func() hash.Hash) []byte {
+	prf := hmac.New(h, password)
+	hashLen := prf.Size()
+	blocks := (keyLen + hashLen - 1) / hashLen
+
+	var key []byte
+	var counter [4]byte
+	for block := 1; block <= blocks; block++ {
+		prf.Reset()
+		prf.Write(salt)
+		binary.BigEndian.PutUint32(counter[:], uint32(block))
+		prf.Write(counter[:])
+		u := prf.Sum(nil)
+
+		t := make([]byte, len(u))
+		copy(t, u)
+		for i := 1; i < iterations; i++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for j := range t {
+				t[j] ^= u[j]
+			}
+		}
+		key = append(key, t...)
+	}
+	return key[:keyLen]
+}
@@ -0,0 +1,56 @@
+package fritzbox_web
+
+// Copyright 2016 Nils Decker
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"encoding/json"
+)
+
+// The state of the cellular connection of LTE/5G models or an LTE stick
+// (Internet > Mobile Network). Values of a missing modem are empty.
+type MobileInfo struct {
+	Connected  Value `json:"connected"`
+	Operator   Value `json:"operator"`
+	Technology Value `json:"act"` // Access technology, e.g. LTE or 5G
+	Band       Value `json:"band"`
+	CellID     Value `json:"cellId"`
+	RSRP       Value `json:"rsrp"` // dBm
+	RSRQ       Value `json:"rsrq"` // dB
+	SINR       Value `json:"sinr"` // dB
+	RSSI       Value `json:"rssi"` // dBm
+}
+
+// Available returns if the box has a mobile modem.
+func (m *MobileInfo) Available() bool {
+	return m.Connected != "" || m.Technology != "" || m.RSRP != ""
+}
+
+// MobileInfo returns the state of the cellular connection. Use Available to
+// check if the box has a mobile modem.
+func (s *Session) MobileInfo() (*MobileInfo, error) {
+	data, err := s.Data("lteSet", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var res struct {
+		Data MobileInfo `json:"data"`
+	}
+	err = json.Unmarshal(data, &res)
+	if err != nil {
+		return nil, err
+	}
+	return &res.Data, nil
+}
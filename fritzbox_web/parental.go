@@ -0,0 +1,46 @@
+package fritzbox_web
+
+// Copyright 2016 Nils Decker
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"encoding/json"
+)
+
+// A device of the parental controls (Internet > Filters > Parental Controls)
+type ParentalControlDevice struct {
+	Name    Value `json:"name"`
+	IP      Value `json:"ip"`
+	MAC     Value `json:"mac"`
+	Profile Value `json:"profile"` // name of the access profile
+}
+
+// ParentalControlDevices returns the devices with their access profiles.
+func (s *Session) ParentalControlDevices() ([]*ParentalControlDevice, error) {
+	data, err := s.Data("kidLis", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var res struct {
+		Data struct {
+			Devices []*ParentalControlDevice `json:"devices"`
+		} `json:"data"`
+	}
+	err = json.Unmarshal(data, &res)
+	if err != nil {
+		return nil, err
+	}
+	return res.Data.Devices, nil
+}
@@ -0,0 +1,274 @@
+// Query the Fritz!OS web interface of Fritz!Box devices.
+package fritzbox_web
+
+// Copyright 2016 Nils Decker
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Fritz!OS invalidates a session after 20 minutes without requests.
+// The session is renewed a bit earlier to avoid races.
+const DefaultSessionTimeout = 19 * time.Minute
+
+// Timeout of a request if the Session has no HTTPClient
+const DefaultTimeout = 30 * time.Second
+
+var defaultHTTPClient = &http.Client{Timeout: DefaultTimeout}
+
+var (
+	ErrLoginFailed = errors.New("login failed")
+	ErrForbidden   = errors.New("access denied")
+)
+
+// A Session is a logged in session of the web interface. The session id (SID) is
+// cached and renewed automatically. A Session is safe for concurrent use.
+type Session struct {
+	BaseUrl  string // e.g. http://fritz.box
+	Username string // If empty the user that logged in last is used
+	Password string
+
+	HTTPClient     *http.Client  // nil means a client with DefaultTimeout
+	SessionTimeout time.Duration // Time after which an unused SID is renewed
+
+	mu       sync.Mutex
+	sid      string
+	lastUsed time.Time
+}
+
+// NewSession creates a session for the web interface at baseUrl.
+// The login is performed with the first request.
+func NewSession(baseUrl, username, password string) *Session {
+	return &Session{
+		BaseUrl:        strings.TrimSuffix(baseUrl, "/"),
+		Username:       username,
+		Password:       password,
+		SessionTimeout: DefaultSessionTimeout,
+	}
+}
+
+func (s *Session) httpClient() *http.Client {
+	if s.HTTPClient == nil {
+		return defaultHTTPClient
+	}
+	return s.HTTPClient
+}
+
+// SID returns the session id, logging in if there is no valid session.
+func (s *Session) SID() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.sid != "" && time.Since(s.lastUsed) < s.SessionTimeout {
+		return s.sid, nil
+	}
+
+	err := s.login()
+	if err != nil {
+		return "", err
+	}
+	return s.sid, nil
+}
+
+// Login performs a new login, even if the current session is still valid.
+func (s *Session) Login() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.login()
+}
+
+func (s *Session) login() error {
+	s.sid = ""
+
+	info, err := s.loginRequest(nil)
+	if err != nil {
+		return err
+	}
+	if info.BlockTime > 0 {
+		return fmt.Errorf("%s: login blocked for %d seconds", ErrLoginFailed, info.BlockTime)
+	}
+
+	response, err := challengeResponse(info.Challenge, s.Password)
+	if err != nil {
+		return err
+	}
+
+	username := s.Username
+	if username == "" {
+		username = info.lastUser()
+	}
+
+	info, err = s.loginRequest(url.Values{
+		"username": {username},
+		"response": {response},
+	})
+	if err != nil {
+		return err
+	}
+	if info.SID == "" || info.SID == invalidSID {
+		return ErrLoginFailed
+	}
+
+	s.sid = info.SID
+	s.lastUsed = time.Now()
+	return nil
+}
+
+// Logout ends the session. It is a no-op if there is no session.
+func (s *Session) Logout() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.sid == "" {
+		return nil
+	}
+
+	_, err := s.loginRequest(url.Values{
+		"logout": {"1"},
+		"sid":    {s.sid},
+	})
+	s.sid = ""
+	return err
+}
+
+// loginRequest posts params to login_sid.lua. With params == nil the current
+// session info including a new challenge is requested.
+func (s *Session) loginRequest(params url.Values) (*sessionInfo, error) {
+	u := s.BaseUrl + "/login_sid.lua?version=2"
+
+	var resp *http.Response
+	var err error
+	if params == nil {
+		resp, err = s.httpClient().Get(u)
+	} else {
+		resp, err = s.httpClient().PostForm(u, params)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: unexpected status %d", u, resp.StatusCode)
+	}
+
+	var info sessionInfo
+	err = xml.NewDecoder(resp.Body).Decode(&info)
+	if err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// Get requests path with the session id and the given query parameters.
+func (s *Session) Get(path string, params url.Values) ([]byte, error) {
+	return s.do("GET", path, params)
+}
+
+// Post sends params with the session id as form to path.
+func (s *Session) Post(path string, params url.Values) ([]byte, error) {
+	return s.do("POST", path, params)
+}
+
+// Data requests a page from data.lua, e.g. "docInfo" or "ecoStat".
+// Most pages answer with JSON.
+func (s *Session) Data(page string, params url.Values) ([]byte, error) {
+	p := url.Values{}
+	for k, v := range params {
+		p[k] = v
+	}
+	p.Set("page", page)
+	p.Set("xhr", "1")
+	p.Set("lang", "en")
+
+	return s.Post("/data.lua", p)
+}
+
+// Query requests variables from query.lua. Keys of params are the names in the
+// JSON answer, values the queried variables, e.g. "cpu" : "cpu:status/StatTemperature".
+func (s *Session) Query(params url.Values) ([]byte, error) {
+	return s.Get("/query.lua", params)
+}
+
+// do sends a request. If the box rejects the session id, a new login is
+// performed and the request is sent once more.
+func (s *Session) do(method, path string, params url.Values) ([]byte, error) {
+	data, err := s.doOnce(method, path, params)
+	if err != ErrForbidden {
+		return data, err
+	}
+
+	err = s.Login()
+	if err != nil {
+		return nil, err
+	}
+	return s.doOnce(method, path, params)
+}
+
+func (s *Session) doOnce(method, path string, params url.Values) ([]byte, error) {
+	sid, err := s.SID()
+	if err != nil {
+		return nil, err
+	}
+
+	p := url.Values{}
+	for k, v := range params {
+		p[k] = v
+	}
+	p.Set("sid", sid)
+
+	u := s.BaseUrl + "/" + strings.TrimPrefix(path, "/")
+
+	var resp *http.Response
+	if method == "POST" {
+		resp, err = s.httpClient().PostForm(u, p)
+	} else {
+		resp, err = s.httpClient().Get(u + "?" + p.Encode())
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusForbidden:
+		return nil, ErrForbidden
+	default:
+		return nil, fmt.Errorf("%s: unexpected status %d", u, resp.StatusCode)
+	}
+
+	s.mu.Lock()
+	if s.sid == sid {
+		s.lastUsed = time.Now()
+	}
+	s.mu.Unlock()
+
+	return data, nil
+}
@@ -0,0 +1,298 @@
+package fritzbox_web
+
+// Copyright 2016 Nils Decker
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// The examples of the AVM technical note
+const (
+	pbkdf2Challenge = "2$10000$5A1711$2000$5A1722"
+	pbkdf2Password  = "1example!"
+	pbkdf2Expected  = "5A1722$1798a1672bca7c6463d6b245f82b53703b0f50813401b03e4045a5861e689adb"
+
+	md5Challenge = "1234567z"
+	md5Password  = "äbc"
+	md5Expected  = "1234567z-9e224a41eeefa284df7bb0f26c2913e2"
+)
+
+// fakeBox serves login_sid.lua, data.lua and query.lua like a Fritz!Box.
+type fakeBox struct {
+	challenge string
+	response  string // the expected response to challenge
+	user      string
+	blockTime int
+
+	mu       sync.Mutex
+	sids     map[string]bool
+	logins   int // successful logins
+	attempts int // posted responses
+	logouts  int
+	requests []string // paths of data.lua and query.lua requests
+}
+
+func newFakeBox(challenge, response string) *fakeBox {
+	return &fakeBox{
+		challenge: challenge,
+		response:  response,
+		user:      "fritz1234",
+		sids:      make(map[string]bool),
+	}
+}
+
+// expire invalidates all sessions, as a reboot of the box does.
+func (b *fakeBox) expire() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.sids = make(map[string]bool)
+}
+
+func (b *fakeBox) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch r.URL.Path {
+	case "/login_sid.lua":
+		b.serveLogin(w, r)
+	case "/data.lua", "/query.lua":
+		b.requests = append(b.requests, r.URL.Path)
+		if !b.sids[r.Form.Get("sid")] {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		fmt.Fprintf(w, `{"page":%q}`, r.Form.Get("page"))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (b *fakeBox) serveLogin(w http.ResponseWriter, r *http.Request) {
+	sid := invalidSID
+
+	switch {
+	case r.Form.Get("logout") != "":
+		if b.sids[r.Form.Get("sid")] {
+			b.logouts++
+		}
+		delete(b.sids, r.Form.Get("sid"))
+
+	case r.Form.Get("response") != "":
+		b.attempts++
+		if r.Form.Get("response") == b.response && r.Form.Get("username") == b.user {
+			b.logins++
+			sid = fmt.Sprintf("%016x", b.logins)
+			b.sids[sid] = true
+		}
+	}
+
+	fmt.Fprintf(w, `<?xml version="1.0" encoding="utf-8"?>
+<SessionInfo><SID>%s</SID><Challenge>%s</Challenge><BlockTime>%d</BlockTime><Rights></Rights>
+<Users><User>admin</User><User last="1">%s</User></Users></SessionInfo>`, sid, b.challenge, b.blockTime, b.user)
+}
+
+func (b *fakeBox) counts() (logins, attempts, logouts int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.logins, b.attempts, b.logouts
+}
+
+func (b *fakeBox) paths() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return append([]string(nil), b.requests...)
+}
+
+func TestLogin(t *testing.T) {
+	tests := []struct {
+		name      string
+		challenge string
+		response  string
+		password  string
+		username  string
+		err       bool
+	}{
+		{"pbkdf2", pbkdf2Challenge, pbkdf2Expected, pbkdf2Password, "", false},
+		{"md5", md5Challenge, md5Expected, md5Password, "", false},
+		{"named user", pbkdf2Challenge, pbkdf2Expected, pbkdf2Password, "fritz1234", false},
+		{"wrong user", pbkdf2Challenge, pbkdf2Expected, pbkdf2Password, "admin", true},
+		{"wrong password", md5Challenge, md5Expected, "abc", "", true},
+	}
+
+	for _, tt := range tests {
+		box := newFakeBox(tt.challenge, tt.response)
+		srv := httptest.NewServer(box)
+
+		s := NewSession(srv.URL, tt.username, tt.password)
+		sid, err := s.SID()
+		srv.Close()
+
+		if tt.err {
+			if err != ErrLoginFailed {
+				t.Errorf("%s: got error %v, want %v", tt.name, err, ErrLoginFailed)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %s", tt.name, err)
+			continue
+		}
+		if sid == "" || sid == invalidSID {
+			t.Errorf("%s: got invalid SID %q", tt.name, sid)
+		}
+	}
+}
+
+func TestLoginBlocked(t *testing.T) {
+	box := newFakeBox(pbkdf2Challenge, pbkdf2Expected)
+	box.blockTime = 32
+	srv := httptest.NewServer(box)
+	defer srv.Close()
+
+	s := NewSession(srv.URL, "", pbkdf2Password)
+	_, err := s.SID()
+	if err == nil || !strings.Contains(err.Error(), "blocked for 32 seconds") {
+		t.Fatalf("got error %v, want login blocked", err)
+	}
+
+	// a blocked box must not see further login attempts
+	if _, attempts, _ := box.counts(); attempts != 0 {
+		t.Errorf("got %d login attempts while blocked, want 0", attempts)
+	}
+}
+
+func TestSessionReuse(t *testing.T) {
+	box := newFakeBox(pbkdf2Challenge, pbkdf2Expected)
+	srv := httptest.NewServer(box)
+	defer srv.Close()
+
+	s := NewSession(srv.URL, "", pbkdf2Password)
+	for i := 0; i < 3; i++ {
+		_, err := s.Data("overview", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if logins, _, _ := box.counts(); logins != 1 {
+		t.Errorf("got %d logins for requests within the session timeout, want 1", logins)
+	}
+
+	// the box drops the session after 20 minutes without requests
+	s.mu.Lock()
+	s.lastUsed = time.Now().Add(-s.SessionTimeout)
+	s.mu.Unlock()
+	box.expire()
+
+	_, err := s.Data("overview", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if logins, _, _ := box.counts(); logins != 2 {
+		t.Errorf("got %d logins after the session timeout, want 2", logins)
+	}
+	if n := len(box.paths()); n != 4 {
+		t.Errorf("got %d requests, want 4: the renewed SID is used without a rejected request", n)
+	}
+}
+
+func TestReloginOnForbidden(t *testing.T) {
+	tests := []struct {
+		path    string
+		request func(s *Session) ([]byte, error)
+	}{
+		{"/data.lua", func(s *Session) ([]byte, error) {
+			return s.Data("overview", nil)
+		}},
+		{"/query.lua", func(s *Session) ([]byte, error) {
+			return s.Query(url.Values{"cpu": {"cpu:status/StatTemperature"}})
+		}},
+	}
+
+	for _, tt := range tests {
+		box := newFakeBox(md5Challenge, md5Expected)
+		srv := httptest.NewServer(box)
+
+		s := NewSession(srv.URL, "", md5Password)
+		_, err := tt.request(s)
+		if err != nil {
+			t.Errorf("%s: %s", tt.path, err)
+		}
+
+		// the box rejects the SID although the session timeout did not pass
+		box.expire()
+
+		_, err = tt.request(s)
+		if err != nil {
+			t.Errorf("%s: %s", tt.path, err)
+		}
+		srv.Close()
+
+		if logins, _, _ := box.counts(); logins != 2 {
+			t.Errorf("%s: got %d logins, want 2", tt.path, logins)
+		}
+		want := []string{tt.path, tt.path, tt.path}
+		if got := box.paths(); strings.Join(got, " ") != strings.Join(want, " ") {
+			t.Errorf("%s: got requests %v, want %v", tt.path, got, want)
+		}
+	}
+}
+
+func TestLogout(t *testing.T) {
+	box := newFakeBox(pbkdf2Challenge, pbkdf2Expected)
+	srv := httptest.NewServer(box)
+	defer srv.Close()
+
+	s := NewSession(srv.URL, "", pbkdf2Password)
+
+	// no session, no request
+	err := s.Logout()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = s.SID()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = s.Logout()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, logouts := box.counts(); logouts != 1 {
+		t.Errorf("got %d logouts, want 1", logouts)
+	}
+
+	// the next request logs in again
+	_, err = s.Data("overview", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if logins, _, _ := box.counts(); logins != 2 {
+		t.Errorf("got %d logins, want 2", logins)
+	}
+}
@@ -0,0 +1,55 @@
+package fritzbox_web
+
+// Copyright 2016 Nils Decker
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"encoding/json"
+)
+
+// A device attached to an USB port (Home Network > USB / Storage > Devices)
+type USBDevice struct {
+	Name       Value        `json:"deviceName"`
+	Type       Value        `json:"deviceType"` // e.g. storage, printer, modem
+	Partitions []*USBVolume `json:"partitions"`
+}
+
+// A volume of an USB storage device
+type USBVolume struct {
+	Name       Value `json:"name"`
+	Filesystem Value `json:"filesystem"`
+	Capacity   Value `json:"totalStorageInBytes"`
+	Used       Value `json:"usedStorageInBytes"`
+}
+
+// USBDevices returns the devices attached to the USB ports.
+func (s *Session) USBDevices() ([]*USBDevice, error) {
+	data, err := s.Data("usbOv", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var res struct {
+		Data struct {
+			Overview struct {
+				Devices []*USBDevice `json:"devices"`
+			} `json:"usbOverview"`
+		} `json:"data"`
+	}
+	err = json.Unmarshal(data, &res)
+	if err != nil {
+		return nil, err
+	}
+	return res.Data.Overview.Devices, nil
+}
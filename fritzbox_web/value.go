@@ -0,0 +1,72 @@
+package fritzbox_web
+
+// Copyright 2016 Nils Decker
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"strings"
+)
+
+// A Value of a JSON answer of data.lua or query.lua. The web interface is not
+// consistent: the same value may be sent as number, string or boolean depending
+// on the page and the firmware version.
+type Value string
+
+func (v *Value) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+
+	if len(data) > 0 && data[0] == '"' {
+		var s string
+		err := json.Unmarshal(data, &s)
+		if err != nil {
+			return err
+		}
+		*v = Value(s)
+		return nil
+	}
+
+	switch string(data) {
+	case "null":
+		*v = ""
+	case "true":
+		*v = "1"
+	case "false":
+		*v = "0"
+	default:
+		*v = Value(data)
+	}
+	return nil
+}
+
+func (v Value) String() string {
+	return string(v)
+}
+
+// Float returns the numeric value. Units and ranges like "751 - 861" are cut off
+// after the first number. ok is false if the value does not start with a number.
+func (v Value) Float() (res float64, ok bool) {
+	fields := strings.Fields(strings.Replace(string(v), ",", ".", 1))
+	if len(fields) == 0 {
+		return 0, false
+	}
+
+	f, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return 0, false
+	}
+	return f, true
+}
@@ -0,0 +1,54 @@
+package fritzbox_web
+
+// Copyright 2016 Nils Decker
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"encoding/json"
+)
+
+// A VPN connection (Internet > Permit Access > VPN). Connections to other
+// boxes and to users are listed, IPSec and WireGuard (Fritz!OS 7.50 and later).
+type VPNConnection struct {
+	Name           Value `json:"name"`
+	Type           Value `json:"type"`      // wireguard or ipsec
+	Active         Value `json:"active"`    // enabled in the configuration
+	Connected      Value `json:"connected"` // tunnel is established
+	RemoteEndpoint Value `json:"remoteIp"`
+	LastHandshake  Value `json:"lastHandshake"` // unix time, WireGuard only
+	BytesReceived  Value `json:"rx"`
+	BytesSent      Value `json:"tx"`
+}
+
+// VPNConnections returns the configured VPN connections.
+func (s *Session) VPNConnections() ([]*VPNConnection, error) {
+	data, err := s.Data("shareVpn", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var res struct {
+		Data struct {
+			Init struct {
+				BoxConnections  []*VPNConnection `json:"boxConnections"`
+				UserConnections []*VPNConnection `json:"userConnections"`
+			} `json:"init"`
+		} `json:"data"`
+	}
+	err = json.Unmarshal(data, &res)
+	if err != nil {
+		return nil, err
+	}
+	return append(res.Data.Init.BoxConnections, res.Data.Init.UserConnections...), nil
+}
@@ -0,0 +1,146 @@
+package main
+
+// Copyright 2016 Nils Decker
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	upnp "github.com/ndecker/fritzbox_exporter/fritzbox_upnp"
+	web "github.com/ndecker/fritzbox_exporter/fritzbox_web"
+)
+
+var (
+	guest_wlan_enabled = prometheus.NewDesc(
+		"fritzbox_guest_wlan_enabled",
+		"Guest WLAN is enabled (1 = enabled)",
+		[]string{"gateway", "ssid"},
+		nil,
+	)
+	guest_lan_enabled = prometheus.NewDesc(
+		"fritzbox_guest_lan_enabled",
+		"Guest access on a LAN port is enabled (1 = enabled)",
+		[]string{"gateway"},
+		nil,
+	)
+	guest_timeout_active = prometheus.NewDesc(
+		"fritzbox_guest_access_timeout_active",
+		"Guest access is switched off automatically (1 = active)",
+		[]string{"gateway"},
+		nil,
+	)
+	guest_timeout = prometheus.NewDesc(
+		"fritzbox_guest_access_timeout_seconds",
+		"Time after which guest access is switched off automatically",
+		[]string{"gateway"},
+		nil,
+	)
+	guest_time_remaining = prometheus.NewDesc(
+		"fritzbox_guest_access_remaining_seconds",
+		"Time until guest access is switched off automatically",
+		[]string{"gateway"},
+		nil,
+	)
+	wlan_night_control = prometheus.NewDesc(
+		"fritzbox_wlan_night_control_enabled",
+		"WLAN is switched off by the night-time schedule (1 = schedule enabled)",
+		[]string{"gateway"},
+		nil,
+	)
+)
+
+// GuestAccessCollector exports the state of guest WLAN and guest LAN, the
+// auto-off timer of guest access and the WLAN night-time schedule.
+type GuestAccessCollector struct {
+	Fritzbox *FritzboxCollector
+	Session  *web.Session // optional, needed for guest LAN
+}
+
+func (c *GuestAccessCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- guest_wlan_enabled
+	ch <- guest_lan_enabled
+	ch <- guest_timeout_active
+	ch <- guest_timeout
+	ch <- guest_time_remaining
+	ch <- wlan_night_control
+}
+
+func (c *GuestAccessCollector) Collect(ch chan<- prometheus.Metric) {
+	root := c.Fritzbox.currentRoot()
+	if root != nil {
+		err := c.collectWLAN(ch, root)
+		if err != nil {
+			fmt.Println("cannot collect guest WLAN:", err)
+			collect_errors.Inc()
+		}
+	}
+
+	if c.Session != nil {
+		guest, err := c.Session.GuestAccess()
+		if err != nil {
+			fmt.Println("cannot get guest access:", err)
+			collect_errors.Inc()
+			return
+		}
+		emitValue(ch, guest_lan_enabled, prometheus.GaugeValue, guest.LANEnabled, c.Fritzbox.Gateway)
+	}
+}
+
+func (c *GuestAccessCollector) collectWLAN(ch chan<- prometheus.Metric, root *upnp.Root) error {
+	gateway := c.Fritzbox.Gateway
+
+	// the schedule is the same for all instances
+	first := wlanServicePrefix + "1"
+	if root.HasAction(first, "X_AVM-DE_GetNightControl") {
+		res, err := root.Call(first, "X_AVM-DE_GetNightControl")
+		if err != nil {
+			return err
+		}
+		emitResult(ch, wlan_night_control, prometheus.GaugeValue, res, "NightControl", gateway)
+	}
+
+	for i := 1; i <= wlanMaxInstances; i++ {
+		service := wlanServicePrefix + strconv.Itoa(i)
+		if !root.HasAction(service, "X_AVM-DE_GetWLANExtInfo") {
+			continue
+		}
+
+		ext, err := root.Call(service, "X_AVM-DE_GetWLANExtInfo")
+		if err != nil {
+			return err
+		}
+		if ext.GetString("X_AVM-DE_APType") != "guest" {
+			continue
+		}
+
+		info, err := root.Call(service, "GetInfo")
+		if err != nil {
+			return err
+		}
+
+		emitResult(ch, guest_wlan_enabled, prometheus.GaugeValue, ext, "X_AVM-DE_APEnabled", gateway, info.GetString("SSID"))
+		emitResult(ch, guest_timeout_active, prometheus.GaugeValue, ext, "X_AVM-DE_TimeoutActive", gateway)
+
+		// in minutes
+		emitScaledResult(ch, guest_timeout, prometheus.GaugeValue, ext, "X_AVM-DE_Timeout", 60, gateway)
+		if ext.GetBool("X_AVM-DE_TimeoutActive") {
+			emitScaledResult(ch, guest_time_remaining, prometheus.GaugeValue, ext, "X_AVM-DE_TimeRemain", 60, gateway)
+		}
+		return nil
+	}
+	return nil
+}
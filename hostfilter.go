@@ -0,0 +1,162 @@
+package main
+
+// Copyright 2016 Nils Decker
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	upnp "github.com/ndecker/fritzbox_exporter/fritzbox_upnp"
+	web "github.com/ndecker/fritzbox_exporter/fritzbox_web"
+)
+
+var host_filter_labels = []string{"gateway", "host", "ip"}
+
+var (
+	host_filter_wan_access = prometheus.NewDesc(
+		"fritzbox_host_filter_wan_access",
+		"Host may access the internet (1 = granted)",
+		host_filter_labels,
+		nil,
+	)
+	host_filter_state = prometheus.NewDesc(
+		"fritzbox_host_filter_state_info",
+		"Internet access of the host: granted, blocked (manually) or limited (by the access profile)",
+		append(host_filter_labels, "state"),
+		nil,
+	)
+	host_filter_profile = prometheus.NewDesc(
+		"fritzbox_host_filter_profile_info",
+		"Access profile of the host in the parental controls",
+		append(host_filter_labels, "profile"),
+		nil,
+	)
+)
+
+// HostFilterCollector exports the internet access of selected hosts as
+// enforced by the parental controls. Online tickets are left out because
+// GetTicketIDStatus needs the ID of a ticket and the tickets cannot be listed.
+type HostFilterCollector struct {
+	Fritzbox *FritzboxCollector
+	Session  *web.Session // optional, needed for the access profiles
+	Hosts    []string     // IP or MAC addresses
+}
+
+func (c *HostFilterCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- host_filter_wan_access
+	ch <- host_filter_state
+	ch <- host_filter_profile
+}
+
+func (c *HostFilterCollector) Collect(ch chan<- prometheus.Metric) {
+	root := c.Fritzbox.currentRoot()
+	if root == nil || root.Services[hostFilterService] == nil {
+		return
+	}
+
+	// the profiles are optional, hosts are exported without them
+	var devices []*web.ParentalControlDevice
+	if c.Session != nil {
+		var err error
+		devices, err = c.Session.ParentalControlDevices()
+		if err != nil {
+			fmt.Println("cannot get parental controls:", err)
+			collect_errors.Inc()
+		}
+	}
+
+	for _, host := range c.Hosts {
+		err := c.collectHost(ch, root, host, devices)
+		if err != nil {
+			fmt.Printf("cannot collect host filter of %s: %s\n", host, err)
+			collect_errors.Inc()
+		}
+	}
+}
+
+func (c *HostFilterCollector) collectHost(ch chan<- prometheus.Metric, root *upnp.Root, host string, devices []*web.ParentalControlDevice) error {
+	ip, mac, err := resolveHost(root, host)
+	if err != nil {
+		return err
+	}
+	labels := []string{c.Fritzbox.Gateway, host, ip}
+
+	res, err := root.Call(hostFilterService, "GetWANAccessByIP", upnp.ActionArgument{Name: "NewIPv4Address", Value: ip})
+	if err != nil {
+		return err
+	}
+
+	var granted float64
+	state := "granted"
+	switch {
+	case res.GetBool("Disallow"):
+		state = "blocked"
+	case res.GetString("WANAccess") != "granted":
+		state = "limited"
+	default:
+		granted = 1
+	}
+	ch <- prometheus.MustNewConstMetric(host_filter_wan_access, prometheus.GaugeValue, granted, labels...)
+	ch <- prometheus.MustNewConstMetric(host_filter_state, prometheus.GaugeValue, 1, append(labels, state)...)
+
+	for _, d := range devices {
+		if d.IP.String() == ip || (mac != "" && strings.EqualFold(d.MAC.String(), mac)) {
+			ch <- prometheus.MustNewConstMetric(host_filter_profile, prometheus.GaugeValue, 1, append(labels, d.Profile.String())...)
+			break
+		}
+	}
+	return nil
+}
+
+// resolveHost returns IP and MAC address of a host given by one of them.
+// The MAC address is empty if the host list does not know the IP address.
+func resolveHost(root *upnp.Root, host string) (ip, mac string, err error) {
+	if net.ParseIP(host) != nil {
+		if !root.HasAction(hostsService, "X_AVM-DE_GetSpecificHostEntryByIP") {
+			return host, "", nil
+		}
+
+		res, err := root.Call(hostsService, "X_AVM-DE_GetSpecificHostEntryByIP", upnp.ActionArgument{Name: "NewIPAddress", Value: host})
+		if err != nil {
+			return host, "", nil
+		}
+		return host, res.GetString("MACAddress"), nil
+	}
+
+	res, err := root.Call(hostsService, "GetSpecificHostEntry", upnp.ActionArgument{Name: "NewMACAddress", Value: host})
+	if err != nil {
+		return "", "", err
+	}
+
+	ip = res.GetString("IPAddress")
+	if ip == "" {
+		return "", "", fmt.Errorf("no IP address known")
+	}
+	return ip, host, nil
+}
+
+// addressList parses a comma separated list of IP or MAC addresses.
+func addressList(s string) []string {
+	var res []string
+	for _, host := range strings.Split(s, ",") {
+		if host = strings.TrimSpace(host); host != "" {
+			res = append(res, host)
+		}
+	}
+	return res
+}
@@ -0,0 +1,243 @@
+package main
+
+// Copyright 2016 Nils Decker
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"encoding/xml"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	upnp "github.com/ndecker/fritzbox_exporter/fritzbox_upnp"
+)
+
+const hostsService = "urn:dslforum-org:service:Hosts:1"
+
+var host_labels = []string{"gateway", "mac", "ip", "hostname"}
+
+var (
+	host_active = prometheus.NewDesc(
+		"fritzbox_host_active",
+		"Host is online (1 = active)",
+		host_labels,
+		nil,
+	)
+	host_speed = prometheus.NewDesc(
+		"fritzbox_host_speed_mbps",
+		"Link speed of the host in Mbit/s",
+		host_labels,
+		nil,
+	)
+	host_info = prometheus.NewDesc(
+		"fritzbox_host_info",
+		"Interface type and address source of the host",
+		append(host_labels, "interface_type", "address_source"),
+		nil,
+	)
+	hosts_count = prometheus.NewDesc(
+		"fritzbox_hosts",
+		"Number of hosts known to the FRITZ!Box",
+		[]string{"gateway", "interface_type"},
+		nil,
+	)
+	hosts_active = prometheus.NewDesc(
+		"fritzbox_hosts_active",
+		"Number of active hosts",
+		[]string{"gateway", "interface_type"},
+		nil,
+	)
+	hosts_dropped = prometheus.NewDesc(
+		"fritzbox_hosts_dropped",
+		"Number of hosts not exported because of -hosts-max",
+		[]string{"gateway"},
+		nil,
+	)
+)
+
+// A host of the Hosts service
+type host struct {
+	MACAddress    string `xml:"MACAddress"`
+	IPAddress     string `xml:"IPAddress"`
+	HostName      string `xml:"HostName"`
+	InterfaceType string `xml:"InterfaceType"`
+	AddressSource string `xml:"AddressSource"`
+	Active        string `xml:"Active"`
+	Speed         string `xml:"X_AVM-DE_Speed"`
+}
+
+type hostList struct {
+	Hosts []*host `xml:"Item"`
+}
+
+// HostsCollector exports the hosts of the LAN and WLAN.
+type HostsCollector struct {
+	Fritzbox *FritzboxCollector
+
+	MaxHosts    int             // Maximum number of hosts with per host metrics
+	AllowedMACs map[string]bool // Only export these hosts, all if empty
+}
+
+func (c *HostsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- host_active
+	ch <- host_speed
+	ch <- host_info
+	ch <- hosts_count
+	ch <- hosts_active
+	ch <- hosts_dropped
+}
+
+func (c *HostsCollector) Collect(ch chan<- prometheus.Metric) {
+	root := c.Fritzbox.currentRoot()
+	if root == nil || root.Services[hostsService] == nil {
+		return
+	}
+
+	hosts, err := c.loadHosts(root)
+	if err != nil {
+		fmt.Println("cannot load hosts:", err)
+		collect_errors.Inc()
+		return
+	}
+
+	gateway := c.Fritzbox.Gateway
+	hosts = uniqueHosts(hosts)
+
+	count := make(map[string]int)
+	active := make(map[string]int)
+	for _, h := range hosts {
+		count[h.InterfaceType]++
+		if h.Active == "1" {
+			active[h.InterfaceType]++
+		}
+	}
+	for iftype, n := range count {
+		ch <- prometheus.MustNewConstMetric(hosts_count, prometheus.GaugeValue, float64(n), gateway, iftype)
+		ch <- prometheus.MustNewConstMetric(hosts_active, prometheus.GaugeValue, float64(active[iftype]), gateway, iftype)
+	}
+
+	var selected []*host
+	for _, h := range hosts {
+		if len(c.AllowedMACs) == 0 || c.AllowedMACs[strings.ToUpper(h.MACAddress)] {
+			selected = append(selected, h)
+		}
+	}
+
+	// active hosts are more interesting, keep them if there are too many
+	sort.SliceStable(selected, func(i, j int) bool {
+		if selected[i].Active != selected[j].Active {
+			return selected[i].Active == "1"
+		}
+		return selected[i].MACAddress < selected[j].MACAddress
+	})
+
+	dropped := 0
+	if c.MaxHosts > 0 && len(selected) > c.MaxHosts {
+		dropped = len(selected) - c.MaxHosts
+		selected = selected[:c.MaxHosts]
+	}
+	ch <- prometheus.MustNewConstMetric(hosts_dropped, prometheus.GaugeValue, float64(dropped), gateway)
+
+	for _, h := range selected {
+		labels := []string{gateway, h.MACAddress, h.IPAddress, h.HostName}
+
+		var activeVal float64
+		if h.Active == "1" {
+			activeVal = 1
+		}
+		ch <- prometheus.MustNewConstMetric(host_active, prometheus.GaugeValue, activeVal, labels...)
+		ch <- prometheus.MustNewConstMetric(host_info, prometheus.GaugeValue, 1,
+			append(labels, h.InterfaceType, h.AddressSource)...)
+
+		var speed float64
+		if _, err := fmt.Sscan(h.Speed, &speed); err == nil {
+			ch <- prometheus.MustNewConstMetric(host_speed, prometheus.GaugeValue, speed, labels...)
+		}
+	}
+}
+
+// loadHosts reads the host list. The XML document of X_AVM-DE_GetHostListPath
+// needs a single request, older firmware has to be queried host by host.
+func (c *HostsCollector) loadHosts(root *upnp.Root) ([]*host, error) {
+	if root.HasAction(hostsService, "X_AVM-DE_GetHostListPath") {
+		res, err := root.Call(hostsService, "X_AVM-DE_GetHostListPath")
+		if err != nil {
+			return nil, err
+		}
+
+		data, err := root.Fetch(res.GetString("X_AVM-DE_HostListPath"))
+		if err != nil {
+			return nil, err
+		}
+
+		var list hostList
+		err = xml.Unmarshal(data, &list)
+		if err != nil {
+			return nil, err
+		}
+		return list.Hosts, nil
+	}
+
+	res, err := root.Call(hostsService, "GetHostNumberOfEntries")
+	if err != nil {
+		return nil, err
+	}
+	n, _ := res.GetFloat("HostNumberOfEntries")
+
+	var hosts []*host
+	for i := 0; i < int(n); i++ {
+		res, err := root.Call(hostsService, "GetGenericHostEntry", upnp.ActionArgument{Name: "NewIndex", Value: i})
+		if err != nil {
+			return nil, err
+		}
+
+		hosts = append(hosts, &host{
+			MACAddress:    res.GetString("MACAddress"),
+			IPAddress:     res.GetString("IPAddress"),
+			HostName:      res.GetString("HostName"),
+			InterfaceType: res.GetString("InterfaceType"),
+			AddressSource: res.GetString("AddressSource"),
+			Active:        res.GetString("Active"),
+		})
+	}
+	return hosts, nil
+}
+
+// uniqueHosts removes duplicate entries. The box may list a host twice,
+// e.g. with an IPv4 address and without any address.
+func uniqueHosts(hosts []*host) []*host {
+	var res []*host
+	seen := make(map[string]bool)
+	for _, h := range hosts {
+		if seen[h.MACAddress] {
+			continue
+		}
+		seen[h.MACAddress] = true
+		res = append(res, h)
+	}
+	return res
+}
+
+// macList parses a comma separated list of MAC addresses.
+func macList(s string) map[string]bool {
+	res := make(map[string]bool)
+	for _, mac := range strings.Split(s, ",") {
+		if mac = strings.TrimSpace(mac); mac != "" {
+			res[strings.ToUpper(mac)] = true
+		}
+	}
+	return res
+}
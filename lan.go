@@ -0,0 +1,201 @@
+package main
+
+// Copyright 2016 Nils Decker
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	upnp "github.com/ndecker/fritzbox_exporter/fritzbox_upnp"
+)
+
+// Fritz!OS has a single LANEthernetInterfaceConfig instance for the LAN bridge,
+// not one per port. Further instances are read should a box report them.
+const lanServicePrefix = "urn:dslforum-org:service:LANEthernetInterfaceConfig:"
+const lanMaxInstances = 8
+
+const lanHostConfigService = "urn:dslforum-org:service:LANHostConfigManagement:1"
+
+var lan_labels = []string{"gateway", "port"}
+
+var (
+	lan_port_up = prometheus.NewDesc(
+		"fritzbox_lan_port_up",
+		"Link of the LAN port is up (1 = up)",
+		lan_labels,
+		nil,
+	)
+	lan_port_info = prometheus.NewDesc(
+		"fritzbox_lan_port_info",
+		"Status, MAC address and duplex mode of the LAN port",
+		append(lan_labels, "status", "mac", "duplex"),
+		nil,
+	)
+	lan_port_speed = prometheus.NewDesc(
+		"fritzbox_lan_port_speed_mbps",
+		"Negotiated speed of the LAN port",
+		lan_labels,
+		nil,
+	)
+	lan_port_bytes = prometheus.NewDesc(
+		"fritzbox_lan_port_bytes",
+		"Bytes sent and received on the LAN port",
+		append(lan_labels, "direction"),
+		nil,
+	)
+	lan_port_packets = prometheus.NewDesc(
+		"fritzbox_lan_port_packets",
+		"Packets sent and received on the LAN port",
+		append(lan_labels, "direction"),
+		nil,
+	)
+	dhcp_server_enabled = prometheus.NewDesc(
+		"fritzbox_dhcp_server_enabled",
+		"DHCP server of the LAN is enabled (1 = enabled)",
+		[]string{"gateway"},
+		nil,
+	)
+	dhcp_pool_info = prometheus.NewDesc(
+		"fritzbox_dhcp_pool_info",
+		"Address range, subnet mask, router and DNS servers handed out by the DHCP server",
+		[]string{"gateway", "min_address", "max_address", "subnet_mask", "router", "dns_servers"},
+		nil,
+	)
+	dhcp_pool_size = prometheus.NewDesc(
+		"fritzbox_dhcp_pool_size",
+		"Number of addresses in the DHCP range",
+		[]string{"gateway"},
+		nil,
+	)
+)
+
+// LANCollector exports the LAN interfaces reported by the box, usually only the
+// bridge, and the DHCP server configuration.
+type LANCollector struct {
+	Fritzbox *FritzboxCollector
+}
+
+func (c *LANCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- lan_port_up
+	ch <- lan_port_info
+	ch <- lan_port_speed
+	ch <- lan_port_bytes
+	ch <- lan_port_packets
+	ch <- dhcp_server_enabled
+	ch <- dhcp_pool_info
+	ch <- dhcp_pool_size
+}
+
+func (c *LANCollector) Collect(ch chan<- prometheus.Metric) {
+	root := c.Fritzbox.currentRoot()
+	if root == nil {
+		return
+	}
+
+	for i := 1; i <= lanMaxInstances; i++ {
+		service := lanServicePrefix + strconv.Itoa(i)
+		if root.Services[service] == nil {
+			continue
+		}
+
+		err := c.collectPort(ch, root, service, strconv.Itoa(i))
+		if err != nil {
+			fmt.Printf("cannot collect %s: %s\n", service, err)
+			collect_errors.Inc()
+		}
+	}
+
+	if root.Services[lanHostConfigService] != nil {
+		err := c.collectDHCP(ch, root)
+		if err != nil {
+			fmt.Println("cannot collect DHCP server:", err)
+			collect_errors.Inc()
+		}
+	}
+}
+
+func (c *LANCollector) collectPort(ch chan<- prometheus.Metric, root *upnp.Root, service, port string) error {
+	labels := []string{c.Fritzbox.Gateway, port}
+
+	info, err := root.Call(service, "GetInfo")
+	if err != nil {
+		return err
+	}
+
+	status := info.GetString("Status")
+	var up float64
+	if status == "Up" {
+		up = 1
+	}
+	ch <- prometheus.MustNewConstMetric(lan_port_up, prometheus.GaugeValue, up, labels...)
+	ch <- prometheus.MustNewConstMetric(lan_port_info, prometheus.GaugeValue, 1,
+		append(labels, status, info.GetString("MACAddress"), info.GetString("DuplexMode"))...)
+
+	// "Auto" if the port is not connected
+	if up == 1 {
+		emitResult(ch, lan_port_speed, prometheus.GaugeValue, info, "MaxBitRate", labels...)
+	}
+
+	stats, err := root.Call(service, "GetStatistics")
+	if err != nil {
+		return err
+	}
+	emitResult(ch, lan_port_bytes, prometheus.CounterValue, stats, "BytesSent", append(labels, "sent")...)
+	emitResult(ch, lan_port_bytes, prometheus.CounterValue, stats, "BytesReceived", append(labels, "received")...)
+	emitResult(ch, lan_port_packets, prometheus.CounterValue, stats, "PacketsSent", append(labels, "sent")...)
+	emitResult(ch, lan_port_packets, prometheus.CounterValue, stats, "PacketsReceived", append(labels, "received")...)
+
+	return nil
+}
+
+func (c *LANCollector) collectDHCP(ch chan<- prometheus.Metric, root *upnp.Root) error {
+	gateway := c.Fritzbox.Gateway
+
+	info, err := root.Call(lanHostConfigService, "GetInfo")
+	if err != nil {
+		return err
+	}
+
+	emitResult(ch, dhcp_server_enabled, prometheus.GaugeValue, info, "DHCPServerEnable", gateway)
+
+	first := info.GetString("MinAddress")
+	last := info.GetString("MaxAddress")
+	ch <- prometheus.MustNewConstMetric(dhcp_pool_info, prometheus.GaugeValue, 1, gateway, first, last,
+		info.GetString("SubnetMask"), info.GetString("IPRouters"), info.GetString("DNSServers"))
+
+	if size, ok := ipv4RangeSize(first, last); ok {
+		ch <- prometheus.MustNewConstMetric(dhcp_pool_size, prometheus.GaugeValue, size, gateway)
+	}
+	return nil
+}
+
+// ipv4RangeSize returns the number of addresses from first to last.
+func ipv4RangeSize(first, last string) (float64, bool) {
+	from := net.ParseIP(first).To4()
+	to := net.ParseIP(last).To4()
+	if from == nil || to == nil {
+		return 0, false
+	}
+
+	n := int64(binary.BigEndian.Uint32(to)) - int64(binary.BigEndian.Uint32(from)) + 1
+	if n < 0 {
+		return 0, false
+	}
+	return float64(n), true
+}
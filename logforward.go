@@ -0,0 +1,267 @@
+package main
+
+// Copyright 2016 Nils Decker
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	upnp "github.com/ndecker/fritzbox_exporter/fritzbox_upnp"
+)
+
+// Maximum number of entries that wait for a forwarder. If a log system is
+// unavailable for longer, the oldest entries are dropped.
+const logQueueSize = 1000
+
+// Maximum number of entries sent at once
+const logBatchSize = 100
+
+// Timeout for connecting and sending to syslog
+const syslogTimeout = 10 * time.Second
+
+// A LogForwarder sends new entries of the event log to a log system.
+type LogForwarder interface {
+	Name() string // e.g. syslog
+	Forward(gateway string, entries []*logEntry) error
+}
+
+// logQueue forwards entries in the background, so a slow log system does not
+// delay the scrape. Entries are removed after they were delivered, failed
+// deliveries are retried with backoff.
+type logQueue struct {
+	Forwarder LogForwarder
+	Gateway   string
+
+	mu      sync.Mutex
+	entries []*logEntry
+	first   uint64 // sequence number of entries[0]
+	dropped uint64
+	wake    chan struct{}
+}
+
+func newLogQueue(forwarder LogForwarder, gateway string) *logQueue {
+	q := &logQueue{
+		Forwarder: forwarder,
+		Gateway:   gateway,
+		wake:      make(chan struct{}, 1),
+	}
+	go q.run()
+	return q
+}
+
+// push adds entries to the queue. If the queue is full, the oldest entries
+// are dropped.
+func (q *logQueue) push(entries []*logEntry) {
+	q.mu.Lock()
+	q.entries = append(q.entries, entries...)
+	if excess := len(q.entries) - logQueueSize; excess > 0 {
+		q.entries = q.entries[excess:]
+		q.first += uint64(excess)
+		q.dropped += uint64(excess)
+	}
+	q.mu.Unlock()
+
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// peek returns the oldest entries and the sequence number of the first one.
+func (q *logQueue) peek() ([]*logEntry, uint64) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	n := len(q.entries)
+	if n > logBatchSize {
+		n = logBatchSize
+	}
+	return append([]*logEntry(nil), q.entries[:n]...), q.first
+}
+
+// remove removes the n entries starting at sequence number seq, unless they
+// were dropped in between.
+func (q *logQueue) remove(seq uint64, n int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	end := seq + uint64(n)
+	if end <= q.first {
+		return
+	}
+	i := int(end - q.first)
+	if i > len(q.entries) {
+		i = len(q.entries)
+	}
+	q.entries = q.entries[i:]
+	q.first += uint64(i)
+}
+
+// stats returns the number of waiting and dropped entries.
+func (q *logQueue) stats() (queued int, dropped uint64) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return len(q.entries), q.dropped
+}
+
+func (q *logQueue) run() {
+	attempt := 0
+	for range q.wake {
+		for {
+			entries, seq := q.peek()
+			if len(entries) == 0 {
+				break
+			}
+
+			err := q.Forwarder.Forward(q.Gateway, entries)
+			if err != nil {
+				fmt.Printf("cannot forward event log to %s: %s\n", q.Forwarder.Name(), err)
+				collect_errors.Inc()
+
+				time.Sleep(upnp.DefaultRetryPolicy.Backoff(attempt))
+				attempt++
+				continue
+			}
+
+			attempt = 0
+			q.remove(seq, len(entries))
+		}
+	}
+}
+
+// SyslogForwarder sends entries as RFC 3164 messages with facility daemon.
+type SyslogForwarder struct {
+	Network string // udp or tcp
+	Address string
+}
+
+// NewSyslogForwarder returns a forwarder for an address like udp://host:514,
+// tcp://host:514 or host:514 (udp).
+func NewSyslogForwarder(address string) *SyslogForwarder {
+	f := &SyslogForwarder{Network: "udp", Address: address}
+	if i := strings.Index(address, "://"); i >= 0 {
+		f.Network = address[:i]
+		f.Address = address[i+3:]
+	}
+	return f
+}
+
+func (f *SyslogForwarder) Name() string {
+	return "syslog"
+}
+
+func (f *SyslogForwarder) Forward(gateway string, entries []*logEntry) error {
+	conn, err := net.DialTimeout(f.Network, f.Address, syslogTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	err = conn.SetWriteDeadline(time.Now().Add(syslogTimeout))
+	if err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		t := e.Time
+		if t.IsZero() {
+			t = time.Now()
+		}
+
+		// <daemon.info>timestamp hostname tag: message
+		msg := fmt.Sprintf("<30>%s %s fritzbox[%s]: %s\n", t.Format(time.Stamp), gateway, e.Category, e.Message)
+		_, err := conn.Write([]byte(msg))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LokiForwarder sends entries to the push API of Loki, e.g.
+// http://localhost:3100/loki/api/v1/push. The lines are labelled with
+// gateway and category.
+type LokiForwarder struct {
+	Url        string
+	HTTPClient *http.Client
+}
+
+func NewLokiForwarder(url string) *LokiForwarder {
+	return &LokiForwarder{
+		Url:        url,
+		HTTPClient: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+type lokiStream struct {
+	Stream map[string]string `json:"stream"`
+	Values [][2]string       `json:"values"`
+}
+
+func (f *LokiForwarder) Name() string {
+	return "loki"
+}
+
+func (f *LokiForwarder) Forward(gateway string, entries []*logEntry) error {
+	streams := make(map[string]*lokiStream)
+	var push struct {
+		Streams []*lokiStream `json:"streams"`
+	}
+
+	for _, e := range entries {
+		s, ok := streams[e.Category]
+		if !ok {
+			s = &lokiStream{Stream: map[string]string{
+				"job":      "fritzbox_exporter",
+				"gateway":  gateway,
+				"category": e.Category,
+			}}
+			streams[e.Category] = s
+			push.Streams = append(push.Streams, s)
+		}
+
+		t := e.Time
+		if t.IsZero() {
+			t = time.Now()
+		}
+		s.Values = append(s.Values, [2]string{strconv.FormatInt(t.UnixNano(), 10), e.Message})
+	}
+
+	body, err := json.Marshal(&push)
+	if err != nil {
+		return err
+	}
+
+	resp, err := f.HTTPClient.Post(f.Url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("%s: %s %s", f.Url, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
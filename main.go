@@ -17,17 +17,27 @@ package main
 import (
 	"flag"
 	"fmt"
+	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"strings"
 	"sync"
+	"syscall"
 	"time"
-	"log"
 
 	"github.com/prometheus/client_golang/prometheus"
 
 	upnp "github.com/ndecker/fritzbox_exporter/fritzbox_upnp"
+	web "github.com/ndecker/fritzbox_exporter/fritzbox_web"
 )
 
-const serviceLoadRetryTime = 1 * time.Minute
+// The delay between attempts to load the services grows with the retry
+// policy but stays within these limits.
+const (
+	serviceLoadMinRetryTime = 1 * time.Second
+	serviceLoadRetryTime    = 1 * time.Minute
+)
 
 var (
 	flag_test = flag.Bool("test", false, "print all available metrics to stdout")
@@ -35,6 +45,48 @@ var (
 
 	flag_gateway_address = flag.String("gateway-address", "fritz.box", "The hostname or IP of the FRITZ!Box")
 	flag_gateway_port    = flag.Int("gateway-port", 49000, "The port of the FRITZ!Box UPnP service")
+	flag_web_url         = flag.String("web-url", "", "The url of the FRITZ!Box web interface (default http://<gateway-address>)")
+	flag_username        = flag.String("username", "", "The user for the FRITZ!Box web interface (default: the user that logged in last)")
+	flag_password        = flag.String("password", "", "The password for the FRITZ!Box web interface and TR-064, enables the web based collectors")
+	flag_descriptions    = flag.String("descriptions", "", "Comma separated list of description documents (paths or urls) to load services from (default: igddesc.xml, and tr64desc.xml if -password is set)")
+
+	flag_request_timeout       = flag.Duration("request-timeout", upnp.DefaultTimeout, "Timeout of a request to the FRITZ!Box")
+	flag_retry_attempts        = flag.Int("retry-attempts", 3, "Number of attempts for a SOAP request with a transient error")
+	flag_retry_initial_backoff = flag.Duration("retry-initial-backoff", 500*time.Millisecond, "Wait time before the first retry")
+	flag_retry_max_backoff     = flag.Duration("retry-max-backoff", 1*time.Minute, "Maximum wait time between retries")
+	flag_breaker_failures      = flag.Int("breaker-failures", 5, "Consecutive failures until requests to the FRITZ!Box are suspended")
+	flag_breaker_timeout       = flag.Duration("breaker-timeout", 30*time.Second, "Time until requests are tried again after the breaker opened")
+
+	flag_max_requests_per_second = flag.Float64("max-requests-per-second", 0, "Maximum SOAP requests per second sent to the FRITZ!Box (0 = unlimited)")
+	flag_request_burst           = flag.Int("request-burst", 1, "Number of requests that may exceed -max-requests-per-second at once")
+	flag_max_concurrent_requests = flag.Int("max-concurrent-requests", 0, "Maximum concurrent SOAP requests to the FRITZ!Box (0 = unlimited)")
+
+	flag_collect_smarthome = flag.Bool("collect-smarthome", true, "Collect metrics of smart home devices (needs -password)")
+	flag_collect_docsis    = flag.Bool("collect-docsis", false, "Collect DOCSIS channel metrics of FRITZ!Box Cable models (needs -password)")
+	flag_collect_traffic   = flag.Bool("collect-traffic-history", true, "Collect the traffic totals of the online monitor (needs -password)")
+	flag_collect_ecostat   = flag.Bool("collect-ecostat", true, "Collect CPU, memory and power consumption of the energy monitor (needs -password)")
+	flag_collect_vpn       = flag.Bool("collect-vpn", true, "Collect the state of the IPSec and WireGuard VPN connections (needs -password)")
+	flag_collect_hosts     = flag.Bool("collect-hosts", true, "Collect metrics of the hosts in the network (needs tr64desc.xml)")
+	flag_hosts_max         = flag.Int("hosts-max", 100, "Maximum number of hosts with per host metrics (0 = unlimited)")
+	flag_hosts_allow_macs  = flag.String("hosts-allow-macs", "", "Comma separated list of MAC addresses to export per host metrics for (default all)")
+	flag_collect_wlan      = flag.Bool("collect-wlan", true, "Collect metrics of the WLAN radios (needs tr64desc.xml)")
+	flag_wlan_stations     = flag.Bool("wlan-stations", false, "Collect signal strength and speed per WLAN station")
+	flag_collect_guest     = flag.Bool("collect-guest-access", true, "Collect guest WLAN/LAN, guest access timer and WLAN night-time schedule (guest LAN needs -password)")
+	flag_collect_mobile    = flag.Bool("collect-mobile", true, "Collect metrics of the LTE/5G connection if the FRITZ!Box has one")
+	flag_collect_telephony = flag.Bool("collect-telephony", true, "Collect SIP registrations, calls and answering machine messages (needs tr64desc.xml)")
+	flag_collect_lan       = flag.Bool("collect-lan", true, "Collect LAN statistics of the bridge and the DHCP server configuration (needs tr64desc.xml)")
+	flag_collect_dsl       = flag.Bool("collect-dsl", true, "Collect line quality metrics of the DSL connection (needs tr64desc.xml)")
+	flag_collect_storage   = flag.Bool("collect-storage", true, "Collect FTP/SMB/media server state and USB volumes (volumes need -password)")
+	flag_collect_dect      = flag.Bool("collect-dect", true, "Collect registration state of the DECT handsets (needs tr64desc.xml)")
+	flag_collect_info      = flag.Bool("collect-device-info", true, "Collect model, firmware and uptime of the FRITZ!Box (needs tr64desc.xml)")
+	flag_collect_log       = flag.Bool("collect-event-log", true, "Count the entries of the event log by category")
+	flag_log_syslog        = flag.String("event-log-syslog", "", "Forward new event log entries to this syslog server (udp://host:514 or tcp://host:514)")
+	flag_log_loki          = flag.String("event-log-loki-url", "", "Forward new event log entries to this Loki push URL (e.g. http://localhost:3100/loki/api/v1/push)")
+	flag_collect_remote    = flag.Bool("collect-remote-access", true, "Collect the state of remote access, dynamic DNS and MyFRITZ! (needs tr64desc.xml)")
+	flag_collect_wan_addr  = flag.Bool("collect-wan-addresses", true, "Collect the external IPv4 and IPv6 addresses and count their changes")
+	flag_host_filter_hosts = flag.String("host-filter-hosts", "", "Comma separated list of IP or MAC addresses of hosts to export the parental controls state for")
+	flag_collect_ports     = flag.Bool("collect-port-mappings", true, "Collect port forwardings and UPnP port mappings")
+	flag_collect_mesh      = flag.Bool("collect-mesh", true, "Collect the mesh topology and serve it on /mesh (needs tr64desc.xml)")
 )
 
 var (
@@ -42,6 +94,25 @@ var (
 		Name: "fritzbox_exporter_collect_errors",
 		Help: "Number of collection errors.",
 	})
+
+	limiter_wait = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "fritzbox_exporter_limiter_wait_seconds",
+		Help:    "Time SOAP requests waited for the rate limiter.",
+		Buckets: []float64{.001, .01, .05, .1, .25, .5, 1, 2.5, 5, 10},
+	}, []string{"gateway"})
+
+	breaker_state_desc = prometheus.NewDesc(
+		"fritzbox_exporter_circuit_breaker_state",
+		"State of the circuit breaker (0 = closed, 1 = open, 2 = half-open)",
+		[]string{"gateway"},
+		nil,
+	)
+	breaker_trips_desc = prometheus.NewDesc(
+		"fritzbox_exporter_circuit_breaker_trips",
+		"Number of times the circuit breaker opened",
+		[]string{"gateway"},
+		nil,
+	)
 )
 
 type Metric struct {
@@ -168,24 +239,32 @@ var metrics = []*Metric{
 }
 
 type FritzboxCollector struct {
-	Gateway string
-	Port    uint16
+	Gateway      string
+	Port         uint16
+	Descriptions []string
+	Client       *upnp.Client
 
 	sync.Mutex // protects Root
 	Root       *upnp.Root
 }
 
-// LoadServices tries to load the service information. Retries until success.
+// LoadServices tries to load the service information. Retries until success,
+// waiting according to the retry policy of the client, but at least a second
+// and at most a minute.
 func (fc *FritzboxCollector) LoadServices() {
-	for {
-		root, err := upnp.LoadServices(fc.Gateway, fc.Port)
+	for attempt := 0; ; attempt++ {
+		root, err := fc.Client.LoadServicesFrom(fc.Gateway, fc.Port, fc.Descriptions...)
 		if err != nil {
 			fmt.Printf("cannot load services: %s\n", err)
 
-			time.Sleep(serviceLoadRetryTime)
+			time.Sleep(serviceLoadDelay(fc.Client.Retry, attempt))
 			continue
 		}
 
+		// the services of the other descriptions are used anyway
+		for _, err := range root.Errors {
+			fmt.Printf("cannot load services: %s\n", err)
+		}
 		fmt.Printf("services loaded\n")
 
 		fc.Lock()
@@ -195,17 +274,39 @@ func (fc *FritzboxCollector) LoadServices() {
 	}
 }
 
+// serviceLoadDelay returns the time to wait before the next attempt to load
+// the services. A policy without backoff must not make the loop spin.
+func serviceLoadDelay(p upnp.RetryPolicy, attempt int) time.Duration {
+	delay := p.Backoff(attempt)
+	if delay > serviceLoadRetryTime {
+		delay = serviceLoadRetryTime
+	}
+	if delay < serviceLoadMinRetryTime {
+		delay = serviceLoadMinRetryTime
+	}
+	return delay
+}
+
+// currentRoot returns the loaded services or nil if they are not loaded yet.
+func (fc *FritzboxCollector) currentRoot() *upnp.Root {
+	fc.Lock()
+	defer fc.Unlock()
+
+	return fc.Root
+}
+
 func (fc *FritzboxCollector) Describe(ch chan<- *prometheus.Desc) {
 	for _, m := range metrics {
 		ch <- m.Desc
 	}
+	ch <- breaker_state_desc
+	ch <- breaker_trips_desc
 }
 
 func (fc *FritzboxCollector) Collect(ch chan<- prometheus.Metric) {
-	fc.Lock()
-	root := fc.Root
-	fc.Unlock()
+	fc.collectBreaker(ch)
 
+	root := fc.currentRoot()
 	if root == nil {
 		// Services not loaded yet
 		return
@@ -251,6 +352,8 @@ func (fc *FritzboxCollector) Collect(ch chan<- prometheus.Metric) {
 		switch tval := val.(type) {
 		case uint64:
 			floatval = float64(tval)
+		case int64:
+			floatval = float64(tval)
 		case bool:
 			if tval {
 				floatval = 1
@@ -279,11 +382,108 @@ func (fc *FritzboxCollector) Collect(ch chan<- prometheus.Metric) {
 	}
 }
 
+func (fc *FritzboxCollector) collectBreaker(ch chan<- prometheus.Metric) {
+	breaker := fc.Client.Breaker
+	if breaker == nil {
+		return
+	}
+
+	ch <- prometheus.MustNewConstMetric(
+		breaker_state_desc,
+		prometheus.GaugeValue,
+		float64(breaker.State()),
+		fc.Gateway,
+	)
+	ch <- prometheus.MustNewConstMetric(
+		breaker_trips_desc,
+		prometheus.CounterValue,
+		float64(breaker.Trips()),
+		fc.Gateway,
+	)
+}
+
+// emitResult sends the value name of res as metric. Missing values are skipped.
+func emitResult(ch chan<- prometheus.Metric, desc *prometheus.Desc, valueType prometheus.ValueType,
+	res upnp.Result, name string, labels ...string) {
+
+	emitScaledResult(ch, desc, valueType, res, name, 1, labels...)
+}
+
+// emitScaledResult sends the value name of res multiplied by factor as metric.
+func emitScaledResult(ch chan<- prometheus.Metric, desc *prometheus.Desc, valueType prometheus.ValueType,
+	res upnp.Result, name string, factor float64, labels ...string) {
+
+	val, ok := res.GetFloat(name)
+	if !ok {
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(desc, valueType, val*factor, labels...)
+}
+
+// emitValue sends a value of the web interface as metric. Missing values are skipped.
+func emitValue(ch chan<- prometheus.Metric, desc *prometheus.Desc, valueType prometheus.ValueType,
+	val web.Value, labels ...string) {
+
+	f, ok := val.Float()
+	if !ok {
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(desc, valueType, f, labels...)
+}
+
+func newClient() *upnp.Client {
+	limiter := upnp.NewLimiter(*flag_max_requests_per_second, *flag_request_burst, *flag_max_concurrent_requests)
+	limiter.Observe = func(wait time.Duration) {
+		limiter_wait.WithLabelValues(*flag_gateway_address).Observe(wait.Seconds())
+	}
+
+	client := &upnp.Client{
+		HTTPClient: &http.Client{Timeout: *flag_request_timeout},
+		Retry: upnp.RetryPolicy{
+			MaxAttempts:    *flag_retry_attempts,
+			InitialBackoff: *flag_retry_initial_backoff,
+			MaxBackoff:     *flag_retry_max_backoff,
+			Multiplier:     upnp.DefaultRetryPolicy.Multiplier,
+			Jitter:         upnp.DefaultRetryPolicy.Jitter,
+		},
+		Breaker: upnp.NewCircuitBreaker(*flag_breaker_failures, *flag_breaker_timeout),
+		Limiter: limiter,
+	}
+
+	if *flag_password != "" {
+		client.SetCredentials(*flag_username, *flag_password)
+	}
+	return client
+}
+
+// descriptions returns the description documents selected by -descriptions.
+// Without the flag the TR-064 services are only loaded with a password:
+// nearly all of their actions are rejected without authentication.
+func descriptions() []string {
+	if *flag_descriptions == "" {
+		if *flag_password == "" {
+			return []string{upnp.IGDDescription}
+		}
+		return []string{upnp.IGDDescription, upnp.TR64Description}
+	}
+
+	var res []string
+	for _, d := range strings.Split(*flag_descriptions, ",") {
+		if d = strings.TrimSpace(d); d != "" {
+			res = append(res, d)
+		}
+	}
+	return res
+}
+
 func test() {
-	root, err := upnp.LoadServices(*flag_gateway_address, uint16(*flag_gateway_port))
+	root, err := newClient().LoadServicesFrom(*flag_gateway_address, uint16(*flag_gateway_port), descriptions()...)
 	if err != nil {
 		panic(err)
 	}
+	for _, err := range root.Errors {
+		fmt.Printf("cannot load services: %s\n", err)
+	}
 
 	for _, s := range root.Services {
 		fmt.Printf("%s: %s\n", s.Device.FriendlyName, s.ServiceType)
@@ -292,12 +492,14 @@ func test() {
 				continue
 			}
 
+			fmt.Printf("  %s\n", a.Name)
+
 			res, err := a.Call()
 			if err != nil {
-				panic(err)
+				fmt.Printf("    error: %s\n", err)
+				continue
 			}
 
-			fmt.Printf("  %s\n", a.Name)
 			for _, arg := range a.Arguments {
 				fmt.Printf("    %s: %v\n", arg.RelatedStateVariable, res[arg.StateVariable.Name])
 			}
@@ -305,6 +507,33 @@ func test() {
 	}
 }
 
+// newSession returns a session for the web interface or nil if no password is configured.
+func newSession() *web.Session {
+	if *flag_password == "" {
+		return nil
+	}
+
+	webUrl := *flag_web_url
+	if webUrl == "" {
+		webUrl = "http://" + *flag_gateway_address
+	}
+	session := web.NewSession(webUrl, *flag_username, *flag_password)
+	session.HTTPClient = &http.Client{Timeout: *flag_request_timeout}
+	return session
+}
+
+// logoutOnSignal ends the web session when the exporter is stopped.
+func logoutOnSignal(session *web.Session) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	<-signals
+	if err := session.Logout(); err != nil {
+		fmt.Printf("cannot log out: %s\n", err)
+	}
+	os.Exit(0)
+}
+
 func main() {
 	flag.Parse()
 
@@ -313,15 +542,132 @@ func main() {
 		return
 	}
 
+	session := newSession()
+	if session != nil {
+		go logoutOnSignal(session)
+
+		if *flag_collect_smarthome {
+			prometheus.MustRegister(&SmartHomeCollector{
+				Gateway: *flag_gateway_address,
+				Session: session,
+			})
+		}
+		if *flag_collect_docsis {
+			prometheus.MustRegister(&DocsisCollector{
+				Gateway: *flag_gateway_address,
+				Session: session,
+			})
+		}
+		if *flag_collect_ecostat {
+			prometheus.MustRegister(&EcoStatCollector{
+				Gateway: *flag_gateway_address,
+				Session: session,
+			})
+		}
+		if *flag_collect_vpn {
+			prometheus.MustRegister(&VPNCollector{
+				Gateway: *flag_gateway_address,
+				Session: session,
+			})
+		}
+		if *flag_collect_traffic {
+			prometheus.MustRegister(&TrafficHistoryCollector{
+				Gateway: *flag_gateway_address,
+				Session: session,
+			})
+		}
+	}
+
 	collector := &FritzboxCollector{
-		Gateway: *flag_gateway_address,
-		Port:    uint16(*flag_gateway_port),
+		Gateway:      *flag_gateway_address,
+		Port:         uint16(*flag_gateway_port),
+		Descriptions: descriptions(),
+		Client:       newClient(),
 	}
 
 	go collector.LoadServices()
 
 	prometheus.MustRegister(collector)
+
+	if *flag_collect_hosts {
+		prometheus.MustRegister(&HostsCollector{
+			Fritzbox:    collector,
+			MaxHosts:    *flag_hosts_max,
+			AllowedMACs: macList(*flag_hosts_allow_macs),
+		})
+	}
+	if *flag_collect_wlan {
+		prometheus.MustRegister(&WLANCollector{
+			Fritzbox: collector,
+			Stations: *flag_wlan_stations,
+		})
+	}
+	if *flag_collect_guest {
+		prometheus.MustRegister(&GuestAccessCollector{
+			Fritzbox: collector,
+			Session:  session,
+		})
+	}
+	if *flag_collect_lan {
+		prometheus.MustRegister(&LANCollector{Fritzbox: collector})
+	}
+	if *flag_collect_dsl {
+		prometheus.MustRegister(&DSLCollector{Fritzbox: collector})
+	}
+	if *flag_collect_telephony {
+		prometheus.MustRegister(NewTelephonyCollector(collector))
+	}
+	if *flag_collect_mobile {
+		prometheus.MustRegister(&MobileCollector{
+			Fritzbox: collector,
+			Session:  session,
+		})
+	}
+	if *flag_collect_storage {
+		prometheus.MustRegister(&StorageCollector{
+			Fritzbox: collector,
+			Session:  session,
+		})
+	}
+	if *flag_collect_dect {
+		prometheus.MustRegister(&DECTCollector{Fritzbox: collector})
+	}
+	if *flag_collect_info {
+		prometheus.MustRegister(NewDeviceInfoCollector(collector))
+	}
+	if *flag_collect_log {
+		var forwarders []LogForwarder
+		if *flag_log_syslog != "" {
+			forwarders = append(forwarders, NewSyslogForwarder(*flag_log_syslog))
+		}
+		if *flag_log_loki != "" {
+			forwarders = append(forwarders, NewLokiForwarder(*flag_log_loki))
+		}
+		prometheus.MustRegister(NewEventLogCollector(collector, session, forwarders...))
+	}
+	if *flag_collect_remote {
+		prometheus.MustRegister(&RemoteAccessCollector{Fritzbox: collector})
+	}
+	if *flag_collect_wan_addr {
+		prometheus.MustRegister(NewWANAddressCollector(collector))
+	}
+	if hosts := addressList(*flag_host_filter_hosts); len(hosts) > 0 {
+		prometheus.MustRegister(&HostFilterCollector{
+			Fritzbox: collector,
+			Session:  session,
+			Hosts:    hosts,
+		})
+	}
+	if *flag_collect_ports {
+		prometheus.MustRegister(&PortMappingCollector{Fritzbox: collector})
+	}
+	if *flag_collect_mesh {
+		mesh := &MeshCollector{Fritzbox: collector}
+		prometheus.MustRegister(mesh)
+		http.Handle("/mesh", mesh)
+	}
 	prometheus.MustRegister(collect_errors)
+	prometheus.MustRegister(limiter_wait)
 
 	http.Handle("/metrics", prometheus.Handler())
 	log.Fatal(http.ListenAndServe(*flag_addr, nil))
@@ -0,0 +1,336 @@
+package main
+
+// Copyright 2016 Nils Decker
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	upnp "github.com/ndecker/fritzbox_exporter/fritzbox_upnp"
+)
+
+// RCPI values above this are reserved (221 - 254) or mean unknown (255)
+const meshMaxRCPI = 220
+
+// Links are labelled by the MAC addresses of the nodes, the names of the nodes
+// need not be unique. Join fritzbox_mesh_node_info on mac for the names.
+var mesh_link_labels = []string{"gateway", "mac", "peer_mac", "type", "interface"}
+
+var (
+	mesh_node_info = prometheus.NewDesc(
+		"fritzbox_mesh_node_info",
+		"Model, firmware and role (master or slave) of a mesh node",
+		[]string{"gateway", "node", "mac", "model", "firmware", "role"},
+		nil,
+	)
+	mesh_link_connected = prometheus.NewDesc(
+		"fritzbox_mesh_link_connected",
+		"Link between two mesh nodes is connected (1 = connected)",
+		mesh_link_labels,
+		nil,
+	)
+	mesh_link_datarate = prometheus.NewDesc(
+		"fritzbox_mesh_link_datarate_kbps",
+		"Current data rate of a link between two mesh nodes",
+		append(mesh_link_labels, "direction"),
+		nil,
+	)
+	mesh_link_max_datarate = prometheus.NewDesc(
+		"fritzbox_mesh_link_max_datarate_kbps",
+		"Maximum data rate of a link between two mesh nodes",
+		append(mesh_link_labels, "direction"),
+		nil,
+	)
+	mesh_link_signal = prometheus.NewDesc(
+		"fritzbox_mesh_link_signal_dbm",
+		"Received signal of a WLAN link between two mesh nodes",
+		append(mesh_link_labels, "direction"),
+		nil,
+	)
+)
+
+var errNoMeshList = errors.New("the FRITZ!Box does not provide a mesh list")
+
+// The mesh list of X_AVM-DE_GetMeshListPath
+type meshList struct {
+	Nodes []struct {
+		UID        string `json:"uid"`
+		Name       string `json:"device_name"`
+		Model      string `json:"device_model"`
+		Firmware   string `json:"device_firmware_version"`
+		MACAddress string `json:"device_mac_address"`
+		IsMeshed   bool   `json:"is_meshed"`
+		Role       string `json:"mesh_role"`
+		Interfaces []struct {
+			Name  string `json:"name"`
+			Links []struct {
+				UID       string  `json:"uid"`
+				Type      string  `json:"type"`
+				State     string  `json:"state"`
+				Node1     string  `json:"node_1_uid"`
+				Node2     string  `json:"node_2_uid"`
+				MaxRateRx float64 `json:"max_data_rate_rx"`
+				MaxRateTx float64 `json:"max_data_rate_tx"`
+				CurRateRx float64 `json:"cur_data_rate_rx"`
+				CurRateTx float64 `json:"cur_data_rate_tx"`
+				RxRCPI    float64 `json:"rx_rcpi"`
+				TxRCPI    float64 `json:"tx_rcpi"`
+			} `json:"node_links"`
+		} `json:"node_interfaces"`
+	} `json:"nodes"`
+}
+
+// MeshNode is a node of the mesh graph.
+type MeshNode struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	MACAddress string `json:"mac"`
+	Model      string `json:"model"`
+	Firmware   string `json:"firmware"`
+	Role       string `json:"role"`
+}
+
+// MeshLink is a link between two nodes of the mesh graph. Data rates are
+// in kbit/s, the signal in dBm.
+type MeshLink struct {
+	ID            string   `json:"id"`
+	From          string   `json:"from"`
+	To            string   `json:"to"`
+	Type          string   `json:"type"`
+	Interface     string   `json:"interface"`
+	Connected     bool     `json:"connected"`
+	DataRateRx    float64  `json:"datarate_rx"`
+	DataRateTx    float64  `json:"datarate_tx"`
+	MaxDataRateRx float64  `json:"max_datarate_rx"`
+	MaxDataRateTx float64  `json:"max_datarate_tx"`
+	SignalRx      *float64 `json:"signal_rx,omitempty"`
+	SignalTx      *float64 `json:"signal_tx,omitempty"`
+}
+
+// MeshGraph contains the mesh nodes and the links between them. Clients
+// of the mesh are left out.
+type MeshGraph struct {
+	Nodes []*MeshNode `json:"nodes"`
+	Links []*MeshLink `json:"links"`
+}
+
+// MeshCollector exports the mesh topology. It also serves the topology
+// as JSON or Graphviz DOT document.
+type MeshCollector struct {
+	Fritzbox *FritzboxCollector
+}
+
+func (c *MeshCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- mesh_node_info
+	ch <- mesh_link_connected
+	ch <- mesh_link_datarate
+	ch <- mesh_link_max_datarate
+	ch <- mesh_link_signal
+}
+
+func (c *MeshCollector) Collect(ch chan<- prometheus.Metric) {
+	root := c.Fritzbox.currentRoot()
+	if root == nil || !root.HasAction(hostsService, "X_AVM-DE_GetMeshListPath") {
+		return
+	}
+
+	graph, err := loadMeshGraph(root)
+	if err != nil {
+		fmt.Println("cannot load mesh list:", err)
+		collect_errors.Inc()
+		return
+	}
+
+	gateway := c.Fritzbox.Gateway
+
+	macs := make(map[string]string)
+	for _, n := range graph.Nodes {
+		macs[n.ID] = n.MACAddress
+		ch <- prometheus.MustNewConstMetric(mesh_node_info, prometheus.GaugeValue, 1,
+			gateway, n.Name, n.MACAddress, n.Model, n.Firmware, n.Role)
+	}
+
+	for _, l := range graph.Links {
+		labels := []string{gateway, macs[l.From], macs[l.To], l.Type, l.Interface}
+
+		var connected float64
+		if l.Connected {
+			connected = 1
+		}
+		ch <- prometheus.MustNewConstMetric(mesh_link_connected, prometheus.GaugeValue, connected, labels...)
+
+		ch <- prometheus.MustNewConstMetric(mesh_link_datarate, prometheus.GaugeValue, l.DataRateRx, append(labels, "rx")...)
+		ch <- prometheus.MustNewConstMetric(mesh_link_datarate, prometheus.GaugeValue, l.DataRateTx, append(labels, "tx")...)
+		ch <- prometheus.MustNewConstMetric(mesh_link_max_datarate, prometheus.GaugeValue, l.MaxDataRateRx, append(labels, "rx")...)
+		ch <- prometheus.MustNewConstMetric(mesh_link_max_datarate, prometheus.GaugeValue, l.MaxDataRateTx, append(labels, "tx")...)
+
+		if l.SignalRx != nil {
+			ch <- prometheus.MustNewConstMetric(mesh_link_signal, prometheus.GaugeValue, *l.SignalRx, append(labels, "rx")...)
+		}
+		if l.SignalTx != nil {
+			ch <- prometheus.MustNewConstMetric(mesh_link_signal, prometheus.GaugeValue, *l.SignalTx, append(labels, "tx")...)
+		}
+	}
+}
+
+// ServeHTTP serves the mesh graph as JSON or, with ?format=dot, as Graphviz DOT.
+func (c *MeshCollector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	root := c.Fritzbox.currentRoot()
+	if root == nil || !root.HasAction(hostsService, "X_AVM-DE_GetMeshListPath") {
+		http.Error(w, errNoMeshList.Error(), http.StatusNotFound)
+		return
+	}
+
+	graph, err := loadMeshGraph(root)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	switch r.URL.Query().Get("format") {
+	case "", "json":
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.Encode(graph)
+	case "dot":
+		w.Header().Set("Content-Type", "text/vnd.graphviz")
+		w.Write(graph.Dot())
+	default:
+		http.Error(w, "unknown format, use json or dot", http.StatusBadRequest)
+	}
+}
+
+// Dot returns the graph in the Graphviz DOT language.
+func (g *MeshGraph) Dot() []byte {
+	var b bytes.Buffer
+
+	b.WriteString("graph mesh {\n")
+	for _, n := range g.Nodes {
+		label := n.Name + "\\n" + n.Model + " " + n.Firmware + "\\n" + n.Role
+		fmt.Fprintf(&b, "\t%s [label=%s];\n", dotQuote(n.ID), dotQuote(label))
+	}
+	for _, l := range g.Links {
+		label := fmt.Sprintf("%s %s\\n%.0f/%.0f Mbit/s", l.Type, l.Interface, l.DataRateRx/1000, l.DataRateTx/1000)
+		style := "solid"
+		if !l.Connected {
+			style = "dashed"
+		}
+		fmt.Fprintf(&b, "\t%s -- %s [label=%s, style=%s];\n",
+			dotQuote(l.From), dotQuote(l.To), dotQuote(label), style)
+	}
+	b.WriteString("}\n")
+
+	return b.Bytes()
+}
+
+func loadMeshGraph(root *upnp.Root) (*MeshGraph, error) {
+	res, err := root.Call(hostsService, "X_AVM-DE_GetMeshListPath")
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := root.Fetch(res.GetString("X_AVM-DE_MeshListPath"))
+	if err != nil {
+		return nil, err
+	}
+
+	var list meshList
+	err = json.Unmarshal(data, &list)
+	if err != nil {
+		return nil, err
+	}
+	return list.graph(), nil
+}
+
+// graph builds the graph of the meshed nodes. Every link is listed at the
+// interfaces of both nodes, the one of the first node is used.
+func (l *meshList) graph() *MeshGraph {
+	g := &MeshGraph{}
+
+	meshed := make(map[string]bool)
+	for _, n := range l.Nodes {
+		if !n.IsMeshed {
+			continue
+		}
+		meshed[n.UID] = true
+		g.Nodes = append(g.Nodes, &MeshNode{
+			ID:         n.UID,
+			Name:       n.Name,
+			MACAddress: n.MACAddress,
+			Model:      n.Model,
+			Firmware:   n.Firmware,
+			Role:       n.Role,
+		})
+	}
+
+	seen := make(map[string]bool)
+	for _, n := range l.Nodes {
+		if !n.IsMeshed {
+			continue
+		}
+		for _, iface := range n.Interfaces {
+			for _, link := range iface.Links {
+				if n.UID != link.Node1 || seen[link.UID] || !meshed[link.Node2] {
+					continue
+				}
+				seen[link.UID] = true
+
+				ml := &MeshLink{
+					ID:            link.UID,
+					From:          link.Node1,
+					To:            link.Node2,
+					Type:          link.Type,
+					Interface:     iface.Name,
+					Connected:     link.State == "CONNECTED",
+					DataRateRx:    link.CurRateRx,
+					DataRateTx:    link.CurRateTx,
+					MaxDataRateRx: link.MaxRateRx,
+					MaxDataRateTx: link.MaxRateTx,
+				}
+				if link.Type == "WLAN" {
+					ml.SignalRx = meshSignal(link.RxRCPI)
+					ml.SignalTx = meshSignal(link.TxRCPI)
+				}
+				g.Links = append(g.Links, ml)
+			}
+		}
+	}
+
+	sort.Slice(g.Links, func(i, j int) bool { return g.Links[i].ID < g.Links[j].ID })
+	return g
+}
+
+// dotQuote quotes s as DOT string. Line breaks written as \n are kept.
+func dotQuote(s string) string {
+	return `"` + strings.Replace(s, `"`, `\"`, -1) + `"`
+}
+
+// meshSignal converts the RCPI of a link to dBm as defined by IEEE 802.11k:
+// RCPI = (dBm + 110) * 2. It returns nil if the signal is unknown.
+func meshSignal(rcpi float64) *float64 {
+	if rcpi <= 0 || rcpi > meshMaxRCPI {
+		return nil
+	}
+	dbm := rcpi/2 - 110
+	return &dbm
+}
@@ -0,0 +1,200 @@
+package main
+
+// Copyright 2016 Nils Decker
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	upnp "github.com/ndecker/fritzbox_exporter/fritzbox_upnp"
+	web "github.com/ndecker/fritzbox_exporter/fritzbox_web"
+)
+
+const mobileService = "urn:dslforum-org:service:X_AVM-DE_WANMobileConnection:1"
+
+var (
+	mobile_connected = prometheus.NewDesc(
+		"fritzbox_mobile_connected",
+		"Cellular connection is established (1 = connected)",
+		[]string{"gateway"},
+		nil,
+	)
+	mobile_info = prometheus.NewDesc(
+		"fritzbox_mobile_info",
+		"Operator, technology, band and cell of the cellular connection",
+		[]string{"gateway", "operator", "technology", "band", "cell_id"},
+		nil,
+	)
+	mobile_rsrp = prometheus.NewDesc(
+		"fritzbox_mobile_rsrp_dbm",
+		"Reference signal received power",
+		[]string{"gateway"},
+		nil,
+	)
+	mobile_rsrq = prometheus.NewDesc(
+		"fritzbox_mobile_rsrq_db",
+		"Reference signal received quality",
+		[]string{"gateway"},
+		nil,
+	)
+	mobile_sinr = prometheus.NewDesc(
+		"fritzbox_mobile_sinr_db",
+		"Signal to interference plus noise ratio",
+		[]string{"gateway"},
+		nil,
+	)
+	mobile_rssi = prometheus.NewDesc(
+		"fritzbox_mobile_rssi_dbm",
+		"Received signal strength indicator",
+		[]string{"gateway"},
+		nil,
+	)
+)
+
+// Time until the web interface is asked again after it reported no modem, so
+// a stick attached later or a modem starting up is noticed.
+const mobileWebRecheckTime = 5 * time.Minute
+
+// MobileCollector exports the cellular connection of LTE/5G models and LTE sticks.
+// It reads the TR-064 service and uses the web interface if the service is missing.
+// Boxes without a mobile modem are skipped quietly. After the web interface
+// reported no modem it is not asked for mobileWebRecheckTime.
+type MobileCollector struct {
+	Fritzbox *FritzboxCollector
+	Session  *web.Session // optional
+
+	mu             sync.Mutex
+	webAbsentUntil time.Time // the web interface reported no modem
+}
+
+func (c *MobileCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- mobile_connected
+	ch <- mobile_info
+	ch <- mobile_rsrp
+	ch <- mobile_rsrq
+	ch <- mobile_sinr
+	ch <- mobile_rssi
+}
+
+func (c *MobileCollector) Collect(ch chan<- prometheus.Metric) {
+	root := c.Fritzbox.currentRoot()
+	if root == nil {
+		return
+	}
+
+	switch {
+	case root.Services[mobileService] != nil:
+		err := c.collectTR64(ch, root)
+		if err != nil {
+			fmt.Println("cannot collect mobile connection:", err)
+			collect_errors.Inc()
+		}
+	case c.Session != nil:
+		err := c.collectWeb(ch)
+		if err != nil {
+			fmt.Println("cannot collect mobile connection:", err)
+			collect_errors.Inc()
+		}
+	}
+}
+
+func (c *MobileCollector) collectTR64(ch chan<- prometheus.Metric, root *upnp.Root) error {
+	gateway := c.Fritzbox.Gateway
+
+	info, err := root.Call(mobileService, "GetInfo")
+	if err != nil {
+		return err
+	}
+	if !info.GetBool("Enabled") {
+		// no modem or stick attached
+		return nil
+	}
+
+	ex, err := root.Call(mobileService, "GetInfoEx")
+	if err != nil {
+		return err
+	}
+
+	var connected float64
+	if ex.GetString("ConnectionStatus") == "Connected" {
+		connected = 1
+	}
+	ch <- prometheus.MustNewConstMetric(mobile_connected, prometheus.GaugeValue, connected, gateway)
+
+	ch <- prometheus.MustNewConstMetric(mobile_info, prometheus.GaugeValue, 1, gateway,
+		ex.GetString("Operator"),
+		ex.GetString(firstResult(ex, "CurrentAccessTechnology", "AccessTechnology")),
+		ex.GetString(firstResult(ex, "CurrentBand", "Band")),
+		ex.GetString(firstResult(ex, "CellID", "CellId")),
+	)
+
+	// depending on the modem the values of the first antenna carry a suffix
+	emitResult(ch, mobile_rsrp, prometheus.GaugeValue, ex, firstResult(ex, "SignalRSRP0", "SignalRSRP"), gateway)
+	emitResult(ch, mobile_rsrq, prometheus.GaugeValue, ex, firstResult(ex, "SignalRSRQ0", "SignalRSRQ"), gateway)
+	emitResult(ch, mobile_sinr, prometheus.GaugeValue, ex, firstResult(ex, "SignalSINR0", "SignalSINR"), gateway)
+	emitResult(ch, mobile_rssi, prometheus.GaugeValue, ex, firstResult(ex, "SignalRSSI0", "SignalRSSI"), gateway)
+
+	return nil
+}
+
+func (c *MobileCollector) collectWeb(ch chan<- prometheus.Metric) error {
+	gateway := c.Fritzbox.Gateway
+
+	c.mu.Lock()
+	absent := time.Now().Before(c.webAbsentUntil)
+	c.mu.Unlock()
+	if absent {
+		return nil
+	}
+
+	info, err := c.Session.MobileInfo()
+	if err != nil {
+		return err
+	}
+	if !info.Available() {
+		c.mu.Lock()
+		c.webAbsentUntil = time.Now().Add(mobileWebRecheckTime)
+		c.mu.Unlock()
+		return nil
+	}
+
+	var connected float64
+	if f, _ := info.Connected.Float(); f == 1 {
+		connected = 1
+	}
+	ch <- prometheus.MustNewConstMetric(mobile_connected, prometheus.GaugeValue, connected, gateway)
+
+	ch <- prometheus.MustNewConstMetric(mobile_info, prometheus.GaugeValue, 1, gateway,
+		info.Operator.String(), info.Technology.String(), info.Band.String(), info.CellID.String())
+
+	emitValue(ch, mobile_rsrp, prometheus.GaugeValue, info.RSRP, gateway)
+	emitValue(ch, mobile_rsrq, prometheus.GaugeValue, info.RSRQ, gateway)
+	emitValue(ch, mobile_sinr, prometheus.GaugeValue, info.SINR, gateway)
+	emitValue(ch, mobile_rssi, prometheus.GaugeValue, info.RSSI, gateway)
+	return nil
+}
+
+// firstResult returns the first of names that is contained in res.
+func firstResult(res upnp.Result, names ...string) string {
+	for _, name := range names {
+		if _, ok := res[name]; ok {
+			return name
+		}
+	}
+	return names[0]
+}
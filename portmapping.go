@@ -0,0 +1,198 @@
+package main
+
+// Copyright 2016 Nils Decker
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	upnp "github.com/ndecker/fritzbox_exporter/fritzbox_upnp"
+)
+
+const hostFilterService = "urn:dslforum-org:service:X_AVM-DE_HostFilter:1"
+
+// The port mappings are read from all of these services that are found.
+// TR-064 and IGD list the same mappings, duplicates are exported once.
+var portMappingServices = []string{
+	"urn:dslforum-org:service:WANIPConnection:1",
+	"urn:dslforum-org:service:WANPPPConnection:1",
+	"urn:schemas-upnp-org:service:WANIPConnection:1",
+	"urn:schemas-upnp-org:service:WANPPPConnection:1",
+}
+
+// Upper bound of entries read per service if the box does not report the number
+const maxPortMappings = 1024
+
+var (
+	port_mapping_info = prometheus.NewDesc(
+		"fritzbox_port_mapping_info",
+		"Port forwarding or UPnP port mapping of the WAN connection",
+		[]string{"gateway", "connection", "remote_host", "external_port", "protocol",
+			"internal_client", "internal_port", "description", "enabled"},
+		nil,
+	)
+	port_mappings = prometheus.NewDesc(
+		"fritzbox_port_mappings",
+		"Number of port mappings of the WAN connection",
+		[]string{"gateway", "connection"},
+		nil,
+	)
+	port_mapping_wan_access = prometheus.NewDesc(
+		"fritzbox_port_mapping_client_wan_access",
+		"Internal client of a port mapping may access the internet (1 = granted)",
+		[]string{"gateway", "internal_client"},
+		nil,
+	)
+)
+
+type portMapping struct {
+	RemoteHost     string
+	ExternalPort   string
+	Protocol       string
+	InternalClient string
+	InternalPort   string
+	Description    string
+	Enabled        bool
+}
+
+// PortMappingCollector exports the port forwardings and the port mappings
+// opened by UPnP clients.
+type PortMappingCollector struct {
+	Fritzbox *FritzboxCollector
+}
+
+func (c *PortMappingCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- port_mapping_info
+	ch <- port_mappings
+	ch <- port_mapping_wan_access
+}
+
+func (c *PortMappingCollector) Collect(ch chan<- prometheus.Metric) {
+	root := c.Fritzbox.currentRoot()
+	if root == nil {
+		return
+	}
+
+	gateway := c.Fritzbox.Gateway
+	seen := make(map[string]bool)
+	counts := make(map[string]int)
+	clients := make(map[string]bool)
+
+	for _, service := range portMappingServices {
+		if root.Services[service] == nil {
+			continue
+		}
+
+		mappings, err := loadPortMappings(root, service)
+		if err != nil {
+			fmt.Printf("cannot load port mappings of %s: %s\n", service, err)
+			collect_errors.Inc()
+			continue
+		}
+
+		// e.g. WANIPConnection
+		connection := strings.Split(service, ":")[3]
+		counts[connection] += 0
+
+		for _, m := range mappings {
+			key := connection + "/" + m.RemoteHost + "/" + m.ExternalPort + "/" + m.Protocol
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			counts[connection]++
+
+			enabled := "0"
+			if m.Enabled {
+				enabled = "1"
+			}
+			ch <- prometheus.MustNewConstMetric(port_mapping_info, prometheus.GaugeValue, 1, gateway, connection,
+				m.RemoteHost, m.ExternalPort, m.Protocol, m.InternalClient, m.InternalPort, m.Description, enabled)
+
+			if m.InternalClient != "" {
+				clients[m.InternalClient] = true
+			}
+		}
+	}
+
+	for connection, n := range counts {
+		ch <- prometheus.MustNewConstMetric(port_mappings, prometheus.GaugeValue, float64(n), gateway, connection)
+	}
+
+	if root.Services[hostFilterService] != nil {
+		err := c.collectWANAccess(ch, root, clients)
+		if err != nil {
+			fmt.Println("cannot collect WAN access of port mapping clients:", err)
+			collect_errors.Inc()
+		}
+	}
+}
+
+// collectWANAccess exports if the clients of the port mappings are blocked by
+// the parental controls.
+func (c *PortMappingCollector) collectWANAccess(ch chan<- prometheus.Metric, root *upnp.Root, clients map[string]bool) error {
+	for ip := range clients {
+		res, err := root.Call(hostFilterService, "GetWANAccessByIP", upnp.ActionArgument{Name: "NewIPv4Address", Value: ip})
+		if err != nil {
+			return err
+		}
+
+		var granted float64
+		if res.GetString("WANAccess") == "granted" {
+			granted = 1
+		}
+		ch <- prometheus.MustNewConstMetric(port_mapping_wan_access, prometheus.GaugeValue, granted, c.Fritzbox.Gateway, ip)
+	}
+	return nil
+}
+
+// loadPortMappings reads the port mappings of service. The IGD services do not
+// report the number of entries, they are read until the box reports an invalid index.
+func loadPortMappings(root *upnp.Root, service string) ([]*portMapping, error) {
+	n := maxPortMappings
+	if root.HasAction(service, "GetPortMappingNumberOfEntries") {
+		res, err := root.Call(service, "GetPortMappingNumberOfEntries")
+		if err != nil {
+			return nil, err
+		}
+		f, _ := res.GetFloat("PortMappingNumberOfEntries")
+		n = int(f)
+	}
+
+	var mappings []*portMapping
+	for i := 0; i < n; i++ {
+		res, err := root.Call(service, "GetGenericPortMappingEntry", upnp.ActionArgument{Name: "NewPortMappingIndex", Value: i})
+		if soapErr, ok := err.(*upnp.SOAPError); ok && soapErr.Code == upnp.UPnPErrorSpecifiedArrayIdx {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		// the result is indexed by the state variables, e.g. NewProtocol is PortMappingProtocol
+		mappings = append(mappings, &portMapping{
+			RemoteHost:     res.GetString("RemoteHost"),
+			ExternalPort:   res.GetString("ExternalPort"),
+			Protocol:       res.GetString("PortMappingProtocol"),
+			InternalClient: res.GetString("InternalClient"),
+			InternalPort:   res.GetString("InternalPort"),
+			Description:    res.GetString("PortMappingDescription"),
+			Enabled:        res.GetBool("PortMappingEnabled"),
+		})
+	}
+	return mappings, nil
+}
@@ -0,0 +1,182 @@
+package main
+
+// Copyright 2016 Nils Decker
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"regexp"
+	"strconv"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	upnp "github.com/ndecker/fritzbox_exporter/fritzbox_upnp"
+)
+
+const igdWANIPConnection = "urn:schemas-upnp-org:service:WANIPConnection:1"
+
+const portMappingDescription = `<?xml version="1.0"?>
+<root xmlns="urn:schemas-upnp-org:device-1-0">
+<device>
+<deviceType>urn:schemas-upnp-org:device:InternetGatewayDevice:1</deviceType>
+<friendlyName>FRITZ!Box 7490</friendlyName>
+<deviceList><device><deviceType>urn:schemas-upnp-org:device:WANDevice:1</deviceType>
+<deviceList><device><deviceType>urn:schemas-upnp-org:device:WANConnectionDevice:1</deviceType>
+<serviceList><service>
+<serviceType>urn:schemas-upnp-org:service:WANIPConnection:1</serviceType>
+<serviceId>urn:upnp-org:serviceId:WANIPConn1</serviceId>
+<controlURL>/igdupnp/control/WANIPConn1</controlURL>
+<eventSubURL>/igdupnp/control/WANIPConn1</eventSubURL>
+<SCPDURL>/igdconnSCPD.xml</SCPDURL>
+</service></serviceList>
+</device></deviceList>
+</device></deviceList>
+</device>
+</root>`
+
+// The output arguments are named after their state variables except NewProtocol,
+// NewEnabled and NewLeaseDuration, as in the SCPD of the box.
+const portMappingSCPD = `<?xml version="1.0"?>
+<scpd xmlns="urn:schemas-upnp-org:service-1-0">
+<actionList><action>
+<name>GetGenericPortMappingEntry</name>
+<argumentList>
+<argument><name>NewPortMappingIndex</name><direction>in</direction><relatedStateVariable>PortMappingNumberOfEntries</relatedStateVariable></argument>
+<argument><name>NewRemoteHost</name><direction>out</direction><relatedStateVariable>RemoteHost</relatedStateVariable></argument>
+<argument><name>NewExternalPort</name><direction>out</direction><relatedStateVariable>ExternalPort</relatedStateVariable></argument>
+<argument><name>NewProtocol</name><direction>out</direction><relatedStateVariable>PortMappingProtocol</relatedStateVariable></argument>
+<argument><name>NewInternalPort</name><direction>out</direction><relatedStateVariable>InternalPort</relatedStateVariable></argument>
+<argument><name>NewInternalClient</name><direction>out</direction><relatedStateVariable>InternalClient</relatedStateVariable></argument>
+<argument><name>NewEnabled</name><direction>out</direction><relatedStateVariable>PortMappingEnabled</relatedStateVariable></argument>
+<argument><name>NewPortMappingDescription</name><direction>out</direction><relatedStateVariable>PortMappingDescription</relatedStateVariable></argument>
+<argument><name>NewLeaseDuration</name><direction>out</direction><relatedStateVariable>PortMappingLeaseDuration</relatedStateVariable></argument>
+</argumentList>
+</action></actionList>
+<serviceStateTable>
+<stateVariable><name>PortMappingNumberOfEntries</name><dataType>ui2</dataType></stateVariable>
+<stateVariable><name>RemoteHost</name><dataType>string</dataType></stateVariable>
+<stateVariable><name>ExternalPort</name><dataType>ui2</dataType></stateVariable>
+<stateVariable><name>PortMappingProtocol</name><dataType>string</dataType></stateVariable>
+<stateVariable><name>InternalPort</name><dataType>ui2</dataType></stateVariable>
+<stateVariable><name>InternalClient</name><dataType>string</dataType></stateVariable>
+<stateVariable><name>PortMappingEnabled</name><dataType>boolean</dataType></stateVariable>
+<stateVariable><name>PortMappingDescription</name><dataType>string</dataType></stateVariable>
+<stateVariable><name>PortMappingLeaseDuration</name><dataType>ui4</dataType></stateVariable>
+</serviceStateTable>
+</scpd>`
+
+const portMappingEntry = `<?xml version="1.0"?>
+<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/" s:encodingStyle="http://schemas.xmlsoap.org/soap/encoding/">
+<s:Body><u:GetGenericPortMappingEntryResponse xmlns:u="urn:schemas-upnp-org:service:WANIPConnection:1">
+<NewRemoteHost></NewRemoteHost>
+<NewExternalPort>%d</NewExternalPort>
+<NewProtocol>%s</NewProtocol>
+<NewInternalPort>%d</NewInternalPort>
+<NewInternalClient>%s</NewInternalClient>
+<NewEnabled>%d</NewEnabled>
+<NewPortMappingDescription>%s</NewPortMappingDescription>
+<NewLeaseDuration>0</NewLeaseDuration>
+</u:GetGenericPortMappingEntryResponse></s:Body>
+</s:Envelope>`
+
+const portMappingInvalidIndex = `<?xml version="1.0"?>
+<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/" s:encodingStyle="http://schemas.xmlsoap.org/soap/encoding/">
+<s:Body><s:Fault><faultcode>s:Client</faultcode><faultstring>UPnPError</faultstring>
+<detail><UPnPError xmlns="urn:schemas-upnp-org:control-1-0"><errorCode>713</errorCode>
+<errorDescription>SpecifiedArrayIndexInvalid</errorDescription></UPnPError></detail>
+</s:Fault></s:Body>
+</s:Envelope>`
+
+var portMappingIndex = regexp.MustCompile(`<NewPortMappingIndex>(\d+)</NewPortMappingIndex>`)
+
+// a forwarding of the same port for TCP and UDP and a disabled forwarding
+var testPortMappings = []*portMapping{
+	{ExternalPort: "3074", Protocol: "TCP", InternalClient: "192.168.178.30", InternalPort: "3074", Description: "Xbox", Enabled: true},
+	{ExternalPort: "3074", Protocol: "UDP", InternalClient: "192.168.178.30", InternalPort: "3074", Description: "Xbox", Enabled: true},
+	{ExternalPort: "8443", Protocol: "TCP", InternalClient: "192.168.178.22", InternalPort: "443", Description: "nas https", Enabled: false},
+}
+
+func servePortMappings(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/igddesc.xml":
+		fmt.Fprint(w, portMappingDescription)
+	case "/igdconnSCPD.xml":
+		fmt.Fprint(w, portMappingSCPD)
+	case "/igdupnp/control/WANIPConn1":
+		body, _ := ioutil.ReadAll(r.Body)
+		m := portMappingIndex.FindSubmatch(body)
+		if m == nil {
+			http.Error(w, "no index", http.StatusBadRequest)
+			return
+		}
+		i, _ := strconv.Atoi(string(m[1]))
+		if i >= len(testPortMappings) {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprint(w, portMappingInvalidIndex)
+			return
+		}
+		pm := testPortMappings[i]
+		external, _ := strconv.Atoi(pm.ExternalPort)
+		internal, _ := strconv.Atoi(pm.InternalPort)
+		enabled := 0
+		if pm.Enabled {
+			enabled = 1
+		}
+		fmt.Fprintf(w, portMappingEntry, external, pm.Protocol, internal, pm.InternalClient, enabled, pm.Description)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestLoadPortMappings(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(servePortMappings))
+	defer srv.Close()
+
+	root, err := upnp.NewClient().LoadServicesFromUrl(srv.URL + "/igddesc.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mappings, err := loadPortMappings(root, igdWANIPConnection)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(mappings, testPortMappings) {
+		for i, m := range mappings {
+			t.Logf("mapping %d: %+v", i, *m)
+		}
+		t.Fatalf("got %d mappings, want %+v", len(mappings), testPortMappings)
+	}
+
+	// TCP and UDP of the same port are different mappings
+	c := &PortMappingCollector{Fritzbox: &FritzboxCollector{Gateway: "fritz.box", Root: root}}
+	ch := make(chan prometheus.Metric, 10)
+	c.Collect(ch)
+	close(ch)
+
+	var n int
+	for m := range ch {
+		if m.Desc() == port_mapping_info {
+			n++
+		}
+	}
+	if n != len(testPortMappings) {
+		t.Errorf("got %d port mappings, want %d", n, len(testPortMappings))
+	}
+}
@@ -0,0 +1,167 @@
+package main
+
+// Copyright 2016 Nils Decker
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"fmt"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	upnp "github.com/ndecker/fritzbox_exporter/fritzbox_upnp"
+)
+
+const (
+	remoteAccessService = "urn:dslforum-org:service:X_AVM-DE_RemoteAccess:1"
+	myFritzService      = "urn:dslforum-org:service:X_AVM-DE_MyFritz:1"
+)
+
+// DynDNS states of a successful update
+var ddnsOkStates = map[string]bool{
+	"complete": true,
+	"updated":  true,
+}
+
+var (
+	remote_access_enabled = prometheus.NewDesc(
+		"fritzbox_remote_access_enabled",
+		"Access to the web interface from the internet is enabled (1 = enabled)",
+		[]string{"gateway"},
+		nil,
+	)
+	ddns_enabled = prometheus.NewDesc(
+		"fritzbox_ddns_enabled",
+		"Dynamic DNS is enabled (1 = enabled)",
+		[]string{"gateway", "provider", "domain"},
+		nil,
+	)
+	ddns_status_info = prometheus.NewDesc(
+		"fritzbox_ddns_status_info",
+		"Result of the last dynamic DNS update, e.g. complete, updating, offline",
+		[]string{"gateway", "family", "status"},
+		nil,
+	)
+	ddns_updated = prometheus.NewDesc(
+		"fritzbox_ddns_updated",
+		"Last dynamic DNS update was successful (1 = successful)",
+		[]string{"gateway", "family"},
+		nil,
+	)
+	myfritz_enabled = prometheus.NewDesc(
+		"fritzbox_myfritz_enabled",
+		"MyFRITZ! is enabled (1 = enabled)",
+		[]string{"gateway", "name"},
+		nil,
+	)
+	myfritz_registered = prometheus.NewDesc(
+		"fritzbox_myfritz_registered",
+		"Box is registered at MyFRITZ! (1 = registered)",
+		[]string{"gateway", "name"},
+		nil,
+	)
+)
+
+// RemoteAccessCollector exports the state of remote access, dynamic DNS and MyFRITZ!.
+type RemoteAccessCollector struct {
+	Fritzbox *FritzboxCollector
+}
+
+func (c *RemoteAccessCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- remote_access_enabled
+	ch <- ddns_enabled
+	ch <- ddns_status_info
+	ch <- ddns_updated
+	ch <- myfritz_enabled
+	ch <- myfritz_registered
+}
+
+func (c *RemoteAccessCollector) Collect(ch chan<- prometheus.Metric) {
+	root := c.Fritzbox.currentRoot()
+	if root == nil {
+		return
+	}
+
+	collectors := []struct {
+		service string
+		collect func(chan<- prometheus.Metric, *upnp.Root) error
+	}{
+		{remoteAccessService, c.collectRemoteAccess},
+		{myFritzService, c.collectMyFritz},
+	}
+
+	for _, coll := range collectors {
+		if root.Services[coll.service] == nil {
+			continue
+		}
+
+		err := coll.collect(ch, root)
+		if err != nil {
+			fmt.Printf("cannot collect %s: %s\n", coll.service, err)
+			collect_errors.Inc()
+		}
+	}
+}
+
+func (c *RemoteAccessCollector) collectRemoteAccess(ch chan<- prometheus.Metric, root *upnp.Root) error {
+	gateway := c.Fritzbox.Gateway
+
+	info, err := root.Call(remoteAccessService, "GetInfo")
+	if err != nil {
+		return err
+	}
+	emitResult(ch, remote_access_enabled, prometheus.GaugeValue, info, "Enabled", gateway)
+
+	ddns, err := root.Call(remoteAccessService, "GetDDNSInfo")
+	if err != nil {
+		return err
+	}
+	emitResult(ch, ddns_enabled, prometheus.GaugeValue, ddns, "Enabled", gateway,
+		ddns.GetString("ProviderName"), ddns.GetString("Domain"))
+	if !ddns.GetBool("Enabled") {
+		return nil
+	}
+
+	families := []struct{ name, result string }{
+		{"ipv4", "StatusIPv4"},
+		{"ipv6", "StatusIPv6"},
+	}
+	for _, family := range families {
+		status := ddns.GetString(family.result)
+		if status == "" {
+			continue
+		}
+
+		var ok float64
+		if ddnsOkStates[status] {
+			ok = 1
+		}
+		ch <- prometheus.MustNewConstMetric(ddns_status_info, prometheus.GaugeValue, 1, gateway, family.name, status)
+		ch <- prometheus.MustNewConstMetric(ddns_updated, prometheus.GaugeValue, ok, gateway, family.name)
+	}
+	return nil
+}
+
+func (c *RemoteAccessCollector) collectMyFritz(ch chan<- prometheus.Metric, root *upnp.Root) error {
+	gateway := c.Fritzbox.Gateway
+
+	info, err := root.Call(myFritzService, "GetInfo")
+	if err != nil {
+		return err
+	}
+
+	name := info.GetString("DynDNSName")
+	emitResult(ch, myfritz_enabled, prometheus.GaugeValue, info, "Enabled", gateway, name)
+	emitResult(ch, myfritz_registered, prometheus.GaugeValue, info, "DeviceRegistered", gateway, name)
+	return nil
+}
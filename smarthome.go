@@ -0,0 +1,185 @@
+package main
+
+// Copyright 2016 Nils Decker
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"fmt"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	web "github.com/ndecker/fritzbox_exporter/fritzbox_web"
+)
+
+var smarthome_labels = []string{"gateway", "ain", "name"}
+
+var (
+	smarthome_present = prometheus.NewDesc(
+		"fritzbox_smarthome_present",
+		"Smart home device is connected (1 = connected)",
+		smarthome_labels,
+		nil,
+	)
+	smarthome_switch_state = prometheus.NewDesc(
+		"fritzbox_smarthome_switch_state",
+		"State of the switch (1 = on)",
+		smarthome_labels,
+		nil,
+	)
+	smarthome_power = prometheus.NewDesc(
+		"fritzbox_smarthome_power_watts",
+		"Current power consumption",
+		smarthome_labels,
+		nil,
+	)
+	smarthome_energy = prometheus.NewDesc(
+		"fritzbox_smarthome_energy_watt_hours",
+		"Energy consumed since the device was put into operation",
+		smarthome_labels,
+		nil,
+	)
+	smarthome_voltage = prometheus.NewDesc(
+		"fritzbox_smarthome_voltage_volts",
+		"Current voltage",
+		smarthome_labels,
+		nil,
+	)
+	smarthome_temperature = prometheus.NewDesc(
+		"fritzbox_smarthome_temperature_celsius",
+		"Temperature measured by the device including the configured offset",
+		smarthome_labels,
+		nil,
+	)
+	smarthome_thermostat_actual = prometheus.NewDesc(
+		"fritzbox_smarthome_thermostat_actual_celsius",
+		"Actual temperature measured by the thermostat",
+		smarthome_labels,
+		nil,
+	)
+	smarthome_thermostat_target = prometheus.NewDesc(
+		"fritzbox_smarthome_thermostat_target_celsius",
+		"Target temperature of the thermostat",
+		smarthome_labels,
+		nil,
+	)
+	smarthome_thermostat_comfort = prometheus.NewDesc(
+		"fritzbox_smarthome_thermostat_comfort_celsius",
+		"Comfort temperature of the thermostat",
+		smarthome_labels,
+		nil,
+	)
+	smarthome_thermostat_eco = prometheus.NewDesc(
+		"fritzbox_smarthome_thermostat_eco_celsius",
+		"Eco temperature of the thermostat",
+		smarthome_labels,
+		nil,
+	)
+	smarthome_window_open = prometheus.NewDesc(
+		"fritzbox_smarthome_window_open",
+		"Open window detected by the thermostat (1 = open)",
+		smarthome_labels,
+		nil,
+	)
+	smarthome_battery = prometheus.NewDesc(
+		"fritzbox_smarthome_battery_percent",
+		"Battery level",
+		smarthome_labels,
+		nil,
+	)
+	smarthome_battery_low = prometheus.NewDesc(
+		"fritzbox_smarthome_battery_low",
+		"Battery is low (1 = low)",
+		smarthome_labels,
+		nil,
+	)
+)
+
+// SmartHomeCollector exports the Fritz!DECT devices known to the box
+// through the AHA-HTTP interface.
+type SmartHomeCollector struct {
+	Gateway string
+	Session *web.Session
+}
+
+func (c *SmartHomeCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- smarthome_present
+	ch <- smarthome_switch_state
+	ch <- smarthome_power
+	ch <- smarthome_energy
+	ch <- smarthome_voltage
+	ch <- smarthome_temperature
+	ch <- smarthome_thermostat_actual
+	ch <- smarthome_thermostat_target
+	ch <- smarthome_thermostat_comfort
+	ch <- smarthome_thermostat_eco
+	ch <- smarthome_window_open
+	ch <- smarthome_battery
+	ch <- smarthome_battery_low
+}
+
+func (c *SmartHomeCollector) Collect(ch chan<- prometheus.Metric) {
+	devices, err := c.Session.AHADeviceList()
+	if err != nil {
+		fmt.Println("cannot get smart home devices:", err)
+		collect_errors.Inc()
+		return
+	}
+
+	for _, d := range devices {
+		labels := []string{c.Gateway, d.AIN, d.Name}
+
+		emit := func(desc *prometheus.Desc, valueType prometheus.ValueType, val float64, ok bool) {
+			if ok {
+				ch <- prometheus.MustNewConstMetric(desc, valueType, val, labels...)
+			}
+		}
+		gauge := func(desc *prometheus.Desc, val string, factor float64) {
+			f, ok := web.AHAValue(val, factor)
+			emit(desc, prometheus.GaugeValue, f, ok)
+		}
+
+		gauge(smarthome_present, d.Present, 1)
+		gauge(smarthome_battery, d.Battery, 1)
+		gauge(smarthome_battery_low, d.BatteryLow, 1)
+
+		if d.Switch != nil {
+			gauge(smarthome_switch_state, d.Switch.State, 1)
+		}
+
+		if d.PowerMeter != nil {
+			gauge(smarthome_power, d.PowerMeter.Power, 0.001)
+			gauge(smarthome_voltage, d.PowerMeter.Voltage, 0.001)
+
+			f, ok := web.AHAValue(d.PowerMeter.Energy, 1)
+			emit(smarthome_energy, prometheus.CounterValue, f, ok)
+		}
+
+		if d.Temperature != nil {
+			gauge(smarthome_temperature, d.Temperature.Celsius, 0.1)
+		}
+
+		if t := d.Thermostat; t != nil {
+			thermostat := func(desc *prometheus.Desc, val string) {
+				f, ok := web.AHAThermostatValue(val)
+				emit(desc, prometheus.GaugeValue, f, ok)
+			}
+
+			thermostat(smarthome_thermostat_actual, t.Actual)
+			thermostat(smarthome_thermostat_target, t.Target)
+			thermostat(smarthome_thermostat_comfort, t.Comfort)
+			thermostat(smarthome_thermostat_eco, t.Eco)
+			gauge(smarthome_window_open, t.WindowOpen, 1)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+// Copyright 2016 Nils Decker
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"fmt"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	upnp "github.com/ndecker/fritzbox_exporter/fritzbox_upnp"
+	web "github.com/ndecker/fritzbox_exporter/fritzbox_web"
+)
+
+const (
+	storageService = "urn:dslforum-org:service:X_AVM-DE_Storage:1"
+	upnpService    = "urn:dslforum-org:service:X_AVM-DE_UPnP:1"
+)
+
+var usb_volume_labels = []string{"gateway", "device", "volume", "filesystem"}
+
+var (
+	storage_ftp_enabled = prometheus.NewDesc(
+		"fritzbox_storage_ftp_enabled",
+		"FTP access to the storage is enabled (1 = enabled)",
+		[]string{"gateway"},
+		nil,
+	)
+	storage_ftp_wan_enabled = prometheus.NewDesc(
+		"fritzbox_storage_ftp_wan_enabled",
+		"FTP access to the storage from the internet is enabled (1 = enabled)",
+		[]string{"gateway"},
+		nil,
+	)
+	storage_smb_enabled = prometheus.NewDesc(
+		"fritzbox_storage_smb_enabled",
+		"SMB access to the storage is enabled (1 = enabled)",
+		[]string{"gateway"},
+		nil,
+	)
+	media_server_enabled = prometheus.NewDesc(
+		"fritzbox_media_server_enabled",
+		"UPnP media server is enabled (1 = enabled)",
+		[]string{"gateway"},
+		nil,
+	)
+	usb_device_info = prometheus.NewDesc(
+		"fritzbox_usb_device_info",
+		"Device attached to an USB port",
+		[]string{"gateway", "device", "type"},
+		nil,
+	)
+	usb_volume_capacity = prometheus.NewDesc(
+		"fritzbox_usb_volume_capacity_bytes",
+		"Size of a volume of an USB storage device",
+		usb_volume_labels,
+		nil,
+	)
+	usb_volume_used = prometheus.NewDesc(
+		"fritzbox_usb_volume_used_bytes",
+		"Used space of a volume of an USB storage device",
+		usb_volume_labels,
+		nil,
+	)
+)
+
+// StorageCollector exports the state of the file and media servers and the
+// USB devices. The devices and volumes are only known to the web interface.
+type StorageCollector struct {
+	Fritzbox *FritzboxCollector
+	Session  *web.Session // optional
+}
+
+func (c *StorageCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- storage_ftp_enabled
+	ch <- storage_ftp_wan_enabled
+	ch <- storage_smb_enabled
+	ch <- media_server_enabled
+	ch <- usb_device_info
+	ch <- usb_volume_capacity
+	ch <- usb_volume_used
+}
+
+func (c *StorageCollector) Collect(ch chan<- prometheus.Metric) {
+	root := c.Fritzbox.currentRoot()
+	if root != nil {
+		err := c.collectTR64(ch, root)
+		if err != nil {
+			fmt.Println("cannot collect storage:", err)
+			collect_errors.Inc()
+		}
+	}
+
+	if c.Session != nil {
+		err := c.collectUSB(ch)
+		if err != nil {
+			fmt.Println("cannot get USB devices:", err)
+			collect_errors.Inc()
+		}
+	}
+}
+
+func (c *StorageCollector) collectTR64(ch chan<- prometheus.Metric, root *upnp.Root) error {
+	gateway := c.Fritzbox.Gateway
+
+	if root.Services[storageService] != nil {
+		res, err := root.Call(storageService, "GetInfo")
+		if err != nil {
+			return err
+		}
+		emitResult(ch, storage_ftp_enabled, prometheus.GaugeValue, res, "FTPEnable", gateway)
+		emitResult(ch, storage_ftp_wan_enabled, prometheus.GaugeValue, res, "FTPWANEnable", gateway)
+		emitResult(ch, storage_smb_enabled, prometheus.GaugeValue, res, "SMBEnable", gateway)
+	}
+
+	if root.Services[upnpService] != nil {
+		res, err := root.Call(upnpService, "GetInfo")
+		if err != nil {
+			return err
+		}
+		emitResult(ch, media_server_enabled, prometheus.GaugeValue, res, "UPnPMediaServer", gateway)
+	}
+
+	return nil
+}
+
+func (c *StorageCollector) collectUSB(ch chan<- prometheus.Metric) error {
+	gateway := c.Fritzbox.Gateway
+
+	devices, err := c.Session.USBDevices()
+	if err != nil {
+		return err
+	}
+
+	for _, d := range devices {
+		ch <- prometheus.MustNewConstMetric(usb_device_info, prometheus.GaugeValue, 1, gateway, d.Name.String(), d.Type.String())
+
+		for _, v := range d.Partitions {
+			labels := []string{gateway, d.Name.String(), v.Name.String(), v.Filesystem.String()}
+			emitValue(ch, usb_volume_capacity, prometheus.GaugeValue, v.Capacity, labels...)
+			emitValue(ch, usb_volume_used, prometheus.GaugeValue, v.Used, labels...)
+		}
+	}
+	return nil
+}
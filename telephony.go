@@ -0,0 +1,464 @@
+package main
+
+// Copyright 2016 Nils Decker
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	upnp "github.com/ndecker/fritzbox_exporter/fritzbox_upnp"
+)
+
+const (
+	voipService  = "urn:dslforum-org:service:X_VoIP:1"
+	onTelService = "urn:dslforum-org:service:X_AVM-DE_OnTel:1"
+	tamService   = "urn:dslforum-org:service:X_AVM-DE_TAM:1"
+)
+
+// Call types of the call list
+var callTypes = map[string]string{
+	"1":  "incoming",
+	"2":  "missed",
+	"3":  "outgoing",
+	"10": "blocked",
+}
+
+// Types of calls that are still in progress. They keep their id and get one
+// of callTypes when they end.
+var activeCallTypes = map[string]bool{
+	"9":  true, // incoming
+	"11": true, // outgoing
+}
+
+// Upper bounds of the call duration histogram in seconds. The call list
+// reports durations in whole minutes.
+var callDurationBuckets = []float64{60, 120, 300, 600, 1200, 1800, 3600, 7200}
+
+var (
+	voip_registered = prometheus.NewDesc(
+		"fritzbox_voip_registered",
+		"SIP account is registered (1 = registered)",
+		[]string{"gateway", "index", "number"},
+		nil,
+	)
+	voip_status_info = prometheus.NewDesc(
+		"fritzbox_voip_status_info",
+		"Registration status of a SIP account",
+		[]string{"gateway", "index", "number", "status"},
+		nil,
+	)
+	calls_count = prometheus.NewDesc(
+		"fritzbox_calls",
+		"Number of calls since the exporter started by type (incoming, outgoing, missed, blocked)",
+		[]string{"gateway", "type"},
+		nil,
+	)
+	calls_duration = prometheus.NewDesc(
+		"fritzbox_call_duration_seconds",
+		"Duration of answered calls since the exporter started",
+		[]string{"gateway", "type"},
+		nil,
+	)
+	tam_enabled = prometheus.NewDesc(
+		"fritzbox_tam_enabled",
+		"Answering machine is enabled (1 = enabled)",
+		[]string{"gateway", "tam", "name"},
+		nil,
+	)
+	tam_messages = prometheus.NewDesc(
+		"fritzbox_tam_messages",
+		"Number of messages on the answering machine",
+		[]string{"gateway", "tam", "name"},
+		nil,
+	)
+	tam_messages_new = prometheus.NewDesc(
+		"fritzbox_tam_messages_new",
+		"Number of unread messages on the answering machine",
+		[]string{"gateway", "tam", "name"},
+		nil,
+	)
+)
+
+type numberList struct {
+	Numbers []struct {
+		Number string `xml:"Number"`
+		Type   string `xml:"Type"`
+		Index  string `xml:"Index"`
+	} `xml:"Item"`
+}
+
+type callList struct {
+	Calls []callListEntry `xml:"Call"` // newest first
+}
+
+type callListEntry struct {
+	Id       int    `xml:"Id"`
+	Type     string `xml:"Type"`
+	Duration string `xml:"Duration"` // h:mm
+}
+
+// newestID returns the highest id of the calls, 0 if the list is empty.
+func (l *callList) newestID() int {
+	id := 0
+	for _, call := range l.Calls {
+		if call.Id > id {
+			id = call.Id
+		}
+	}
+	return id
+}
+
+type tamList struct {
+	TAMs []struct {
+		Index   string `xml:"Index"`
+		Display string `xml:"Display"`
+		Enable  string `xml:"Enable"`
+		Name    string `xml:"Name"`
+	} `xml:"Item"`
+}
+
+type tamMessageList struct {
+	Messages []struct {
+		New string `xml:"New"`
+	} `xml:"Message"`
+}
+
+// callHistogram is a histogram of call durations per call type
+type callHistogram struct {
+	count   uint64
+	sum     float64
+	buckets map[float64]uint64
+}
+
+// TelephonyCollector exports the SIP registrations, counts the calls of the
+// call list and the messages on the answering machines.
+type TelephonyCollector struct {
+	Fritzbox *FritzboxCollector
+
+	mu          sync.Mutex
+	lastCallID  int          // -1 until the call list was read once
+	activeCalls map[int]bool // ids of calls in progress, counted when they end
+	calls       map[string]uint64
+	durations   map[string]*callHistogram
+}
+
+func NewTelephonyCollector(fc *FritzboxCollector) *TelephonyCollector {
+	c := &TelephonyCollector{
+		Fritzbox:    fc,
+		lastCallID:  -1,
+		activeCalls: make(map[int]bool),
+		calls:       make(map[string]uint64),
+		durations:   make(map[string]*callHistogram),
+	}
+	for _, t := range callTypes {
+		c.calls[t] = 0
+	}
+	return c
+}
+
+func (c *TelephonyCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- voip_registered
+	ch <- voip_status_info
+	ch <- calls_count
+	ch <- calls_duration
+	ch <- tam_enabled
+	ch <- tam_messages
+	ch <- tam_messages_new
+}
+
+func (c *TelephonyCollector) Collect(ch chan<- prometheus.Metric) {
+	root := c.Fritzbox.currentRoot()
+	if root == nil {
+		return
+	}
+
+	collectors := []struct {
+		service string
+		collect func(chan<- prometheus.Metric, *upnp.Root) error
+	}{
+		{voipService, c.collectVoIP},
+		{onTelService, c.collectCalls},
+		{tamService, c.collectTAM},
+	}
+
+	for _, coll := range collectors {
+		if root.Services[coll.service] == nil {
+			continue
+		}
+
+		err := coll.collect(ch, root)
+		if err != nil {
+			fmt.Printf("cannot collect %s: %s\n", coll.service, err)
+			collect_errors.Inc()
+		}
+	}
+}
+
+func (c *TelephonyCollector) collectVoIP(ch chan<- prometheus.Metric, root *upnp.Root) error {
+	gateway := c.Fritzbox.Gateway
+
+	// the action was renamed in newer firmware
+	action := "X_AVM-DE_GetNumbers"
+	if !root.HasAction(voipService, action) {
+		action = "X_AVM-DE_GetNumberList"
+	}
+
+	res, err := root.Call(voipService, action)
+	if err != nil {
+		return err
+	}
+
+	var list numberList
+	err = xml.Unmarshal([]byte(res.GetString(firstResult(res, "NumberList", "X_AVM-DE_NumberList"))), &list)
+	if err != nil {
+		return err
+	}
+
+	for _, n := range list.Numbers {
+		if n.Type != "eVoIP" {
+			continue
+		}
+
+		status, err := root.Call(voipService, "X_AVM-DE_GetVoIPStatus",
+			upnp.ActionArgument{Name: "NewVoIPAccountIndex", Value: n.Index})
+		if err != nil {
+			return err
+		}
+
+		s := status.GetString(firstResult(status, "X_AVM-DE_VoIPStatus", "VoIPStatus"))
+
+		var registered float64
+		if s == "Registered" {
+			registered = 1
+		}
+		ch <- prometheus.MustNewConstMetric(voip_registered, prometheus.GaugeValue, registered, gateway, n.Index, n.Number)
+		ch <- prometheus.MustNewConstMetric(voip_status_info, prometheus.GaugeValue, 1, gateway, n.Index, n.Number, s)
+	}
+	return nil
+}
+
+// collectCalls reads the calls since the last scrape. The first scrape only
+// remembers the newest call, so the counters start at zero.
+func (c *TelephonyCollector) collectCalls(ch chan<- prometheus.Metric, root *upnp.Root) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	err := c.updateCalls(callListFetcher(root))
+
+	gateway := c.Fritzbox.Gateway
+	for t, n := range c.calls {
+		ch <- prometheus.MustNewConstMetric(calls_count, prometheus.CounterValue, float64(n), gateway, t)
+	}
+	for t, h := range c.durations {
+		ch <- prometheus.MustNewConstHistogram(calls_duration, h.count, h.sum, h.buckets, gateway, t)
+	}
+
+	return err
+}
+
+// callListFetcher returns a function that fetches the call list with additional
+// parameters, e.g. "&max=1" for the newest call or "&id=42" for the calls after
+// call 42. The url of the call list is requested once per scrape.
+func callListFetcher(root *upnp.Root) func(params string) (*callList, error) {
+	var url string
+	return func(params string) (*callList, error) {
+		if url == "" {
+			res, err := root.Call(onTelService, "GetCallList")
+			if err != nil {
+				return nil, err
+			}
+			url = res.GetString(firstResult(res, "X_AVM-DE_CallListURL", "CallListURL"))
+		}
+
+		data, err := root.Fetch(url + params)
+		if err != nil {
+			return nil, err
+		}
+
+		var list callList
+		err = xml.Unmarshal(data, &list)
+		if err != nil {
+			return nil, err
+		}
+		return &list, nil
+	}
+}
+
+// updateCalls counts the calls that were added to the call list since the
+// last scrape. The newest call is requested first: if its id is lower than the
+// last id seen, the call list was cleared and all calls in it are new. Calls in
+// progress are requested again until they end.
+func (c *TelephonyCollector) updateCalls(fetch func(params string) (*callList, error)) error {
+	newest, err := fetch("&max=1")
+	if err != nil {
+		return err
+	}
+	newestID := newest.newestID()
+
+	if c.lastCallID >= 0 && (newestID != c.lastCallID || len(c.activeCalls) > 0) {
+		// the list starts below the oldest call in progress
+		since := c.lastCallID
+		for id := range c.activeCalls {
+			if id-1 < since {
+				since = id - 1
+			}
+		}
+		params := "&id=" + strconv.Itoa(since)
+		if newestID < c.lastCallID {
+			// the call list was cleared
+			c.lastCallID = 0
+			c.activeCalls = make(map[int]bool)
+			params = ""
+		}
+
+		list, err := fetch(params)
+		if err != nil {
+			return err
+		}
+		c.countCalls(list, c.lastCallID)
+
+		// calls that ended in between
+		if id := list.newestID(); id > newestID {
+			newestID = id
+		}
+	}
+
+	c.lastCallID = newestID
+	return nil
+}
+
+// countCalls counts the calls of list with an id greater than since and the
+// calls in progress that ended. New calls in progress are remembered.
+func (c *TelephonyCollector) countCalls(list *callList, since int) {
+	active := make(map[int]bool)
+	for _, call := range list.Calls {
+		if call.Id <= since && !c.activeCalls[call.Id] {
+			continue
+		}
+
+		if activeCallTypes[call.Type] {
+			active[call.Id] = true
+			continue
+		}
+		t, ok := callTypes[call.Type]
+		if !ok {
+			continue
+		}
+		c.calls[t]++
+
+		if duration, ok := parseCallDuration(call.Duration); ok && t != "missed" && t != "blocked" {
+			c.observeDuration(t, duration)
+		}
+	}
+
+	// calls in progress that are missing in the list were deleted
+	c.activeCalls = active
+}
+
+func (c *TelephonyCollector) observeDuration(callType string, seconds float64) {
+	h, ok := c.durations[callType]
+	if !ok {
+		h = &callHistogram{buckets: make(map[float64]uint64)}
+		for _, b := range callDurationBuckets {
+			h.buckets[b] = 0
+		}
+		c.durations[callType] = h
+	}
+
+	h.count++
+	h.sum += seconds
+	for _, b := range callDurationBuckets {
+		if seconds <= b {
+			h.buckets[b]++
+		}
+	}
+}
+
+// parseCallDuration parses a duration of the form h:mm.
+func parseCallDuration(s string) (float64, bool) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 2 {
+		return 0, false
+	}
+
+	hours, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, false
+	}
+	minutes, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return 0, false
+	}
+	return float64(hours*3600 + minutes*60), true
+}
+
+func (c *TelephonyCollector) collectTAM(ch chan<- prometheus.Metric, root *upnp.Root) error {
+	gateway := c.Fritzbox.Gateway
+
+	res, err := root.Call(tamService, "GetList")
+	if err != nil {
+		return err
+	}
+
+	var list tamList
+	err = xml.Unmarshal([]byte(res.GetString(firstResult(res, "TAMList", "X_AVM-DE_TAMList"))), &list)
+	if err != nil {
+		return err
+	}
+
+	for _, tam := range list.TAMs {
+		// answering machines that were never set up are hidden in the web interface
+		if tam.Display != "1" {
+			continue
+		}
+
+		var enabled float64
+		if tam.Enable == "1" {
+			enabled = 1
+		}
+		ch <- prometheus.MustNewConstMetric(tam_enabled, prometheus.GaugeValue, enabled, gateway, tam.Index, tam.Name)
+
+		msgs, err := root.Call(tamService, "GetMessageList", upnp.ActionArgument{Name: "NewIndex", Value: tam.Index})
+		if err != nil {
+			return err
+		}
+
+		data, err := root.Fetch(msgs.GetString(firstResult(msgs, "URL", "MessageListURL")))
+		if err != nil {
+			return err
+		}
+
+		var messages tamMessageList
+		err = xml.Unmarshal(data, &messages)
+		if err != nil {
+			return err
+		}
+
+		unread := 0
+		for _, m := range messages.Messages {
+			if m.New == "1" {
+				unread++
+			}
+		}
+		ch <- prometheus.MustNewConstMetric(tam_messages, prometheus.GaugeValue, float64(len(messages.Messages)), gateway, tam.Index, tam.Name)
+		ch <- prometheus.MustNewConstMetric(tam_messages_new, prometheus.GaugeValue, float64(unread), gateway, tam.Index, tam.Name)
+	}
+	return nil
+}
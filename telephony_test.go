@@ -0,0 +1,231 @@
+package main
+
+// Copyright 2016 Nils Decker
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// fakeCallList answers requests for the call list like the Fritz!Box does
+// for the parameters max and id.
+type fakeCallList struct {
+	calls  []callListEntry // newest first
+	params []string        // parameters of all requests
+}
+
+func (f *fakeCallList) fetch(params string) (*callList, error) {
+	f.params = append(f.params, params)
+
+	list := &callList{}
+	for _, call := range f.calls {
+		if strings.HasPrefix(params, "&id=") {
+			id, _ := strconv.Atoi(strings.TrimPrefix(params, "&id="))
+			if call.Id <= id {
+				continue
+			}
+		}
+		list.Calls = append(list.Calls, call)
+		if params == "&max=1" {
+			break
+		}
+	}
+	return list, nil
+}
+
+// calls returns a call list with ids from first to last (newest first) of
+// the given type and duration.
+func calls(first, last int, callType, duration string) []callListEntry {
+	var list []callListEntry
+	for id := last; id >= first; id-- {
+		list = append(list, callListEntry{Id: id, Type: callType, Duration: duration})
+	}
+	return list
+}
+
+func TestUpdateCalls(t *testing.T) {
+	type scrape struct {
+		calls     []callListEntry
+		params    []string          // expected requests
+		counts    map[string]uint64 // expected counters, types not given must be 0
+		durations map[string]uint64 // expected number of observed durations
+	}
+
+	tests := []struct {
+		name    string
+		scrapes []scrape
+	}{
+		{
+			name: "first scrape",
+			scrapes: []scrape{
+				{calls: calls(1, 5, "1", "0:03"), params: []string{"&max=1"}},
+			},
+		},
+		{
+			name: "empty call list",
+			scrapes: []scrape{
+				{calls: nil, params: []string{"&max=1"}},
+				{calls: calls(1, 2, "3", "0:10"), params: []string{"&max=1", "&id=0"},
+					counts: map[string]uint64{"outgoing": 2}, durations: map[string]uint64{"outgoing": 2}},
+			},
+		},
+		{
+			name: "incremental scrapes",
+			scrapes: []scrape{
+				{calls: calls(1, 5, "1", "0:03"), params: []string{"&max=1"}},
+				{calls: calls(1, 5, "1", "0:03"), params: []string{"&max=1"}},
+				{
+					calls:     append(calls(6, 7, "2", "0:00"), calls(1, 5, "1", "0:03")...),
+					params:    []string{"&max=1", "&id=5"},
+					counts:    map[string]uint64{"missed": 2},
+					durations: map[string]uint64{},
+				},
+				{
+					calls:     append(append(calls(8, 8, "1", "1:02"), calls(6, 7, "2", "0:00")...), calls(1, 5, "1", "0:03")...),
+					params:    []string{"&max=1", "&id=7"},
+					counts:    map[string]uint64{"missed": 2, "incoming": 1},
+					durations: map[string]uint64{"incoming": 1},
+				},
+			},
+		},
+		{
+			name: "call in progress",
+			scrapes: []scrape{
+				{calls: calls(1, 5, "1", "0:03"), params: []string{"&max=1"}},
+				{
+					calls:     append(calls(6, 6, "9", "0:00"), calls(1, 5, "1", "0:03")...),
+					params:    []string{"&max=1", "&id=5"},
+					durations: map[string]uint64{},
+				},
+				{
+					calls:     append(calls(6, 6, "1", "0:12"), calls(1, 5, "1", "0:03")...),
+					params:    []string{"&max=1", "&id=5"},
+					counts:    map[string]uint64{"incoming": 1},
+					durations: map[string]uint64{"incoming": 1},
+				},
+				{
+					calls:     append(calls(6, 6, "1", "0:12"), calls(1, 5, "1", "0:03")...),
+					params:    []string{"&max=1"},
+					counts:    map[string]uint64{"incoming": 1},
+					durations: map[string]uint64{"incoming": 1},
+				},
+			},
+		},
+		{
+			name: "call in progress below newer calls",
+			scrapes: []scrape{
+				{calls: calls(1, 5, "1", "0:03"), params: []string{"&max=1"}},
+				{
+					calls:     append(append(calls(7, 7, "2", "0:00"), calls(6, 6, "11", "0:00")...), calls(1, 5, "1", "0:03")...),
+					params:    []string{"&max=1", "&id=5"},
+					counts:    map[string]uint64{"missed": 1},
+					durations: map[string]uint64{},
+				},
+				{
+					calls:     append(append(calls(7, 7, "2", "0:00"), calls(6, 6, "3", "0:25")...), calls(1, 5, "1", "0:03")...),
+					params:    []string{"&max=1", "&id=5"},
+					counts:    map[string]uint64{"missed": 1, "outgoing": 1},
+					durations: map[string]uint64{"outgoing": 1},
+				},
+			},
+		},
+		{
+			name: "cleared call list",
+			scrapes: []scrape{
+				{calls: calls(1, 40, "1", "0:03"), params: []string{"&max=1"}},
+				{
+					calls:     calls(1, 3, "3", "0:07"),
+					params:    []string{"&max=1", ""},
+					counts:    map[string]uint64{"outgoing": 3},
+					durations: map[string]uint64{"outgoing": 3},
+				},
+				{
+					calls:     calls(1, 4, "3", "0:07"),
+					params:    []string{"&max=1", "&id=3"},
+					counts:    map[string]uint64{"outgoing": 4},
+					durations: map[string]uint64{"outgoing": 4},
+				},
+			},
+		},
+		{
+			name: "cleared to empty call list",
+			scrapes: []scrape{
+				{calls: calls(1, 40, "1", "0:03"), params: []string{"&max=1"}},
+				{calls: nil, params: []string{"&max=1", ""}},
+				{
+					calls:     calls(1, 1, "10", ""),
+					params:    []string{"&max=1", "&id=0"},
+					counts:    map[string]uint64{"blocked": 1},
+					durations: map[string]uint64{},
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		c := NewTelephonyCollector(nil)
+		list := &fakeCallList{}
+
+		for i, s := range tt.scrapes {
+			list.calls = s.calls
+			list.params = nil
+
+			err := c.updateCalls(list.fetch)
+			if err != nil {
+				t.Fatalf("%s, scrape %d: %s", tt.name, i, err)
+			}
+
+			if !reflect.DeepEqual(list.params, s.params) {
+				t.Errorf("%s, scrape %d: got requests %q, want %q", tt.name, i, list.params, s.params)
+			}
+
+			for _, callType := range callTypes {
+				if c.calls[callType] != s.counts[callType] {
+					t.Errorf("%s, scrape %d: got %d %s calls, want %d", tt.name, i, c.calls[callType], callType, s.counts[callType])
+				}
+
+				var observed uint64
+				if h, ok := c.durations[callType]; ok {
+					observed = h.count
+				}
+				if observed != s.durations[callType] {
+					t.Errorf("%s, scrape %d: got %d %s durations, want %d", tt.name, i, observed, callType, s.durations[callType])
+				}
+			}
+		}
+	}
+}
+
+func TestObserveDuration(t *testing.T) {
+	c := NewTelephonyCollector(nil)
+	for _, d := range []string{"0:01", "0:02", "0:05", "1:00", "2:30"} {
+		seconds, ok := parseCallDuration(d)
+		if !ok {
+			t.Fatalf("cannot parse %s", d)
+		}
+		c.observeDuration("incoming", seconds)
+	}
+
+	h := c.durations["incoming"]
+	want := map[float64]uint64{60: 1, 120: 2, 300: 3, 600: 3, 1200: 3, 1800: 3, 3600: 4, 7200: 4}
+	if !reflect.DeepEqual(h.buckets, want) {
+		t.Errorf("got buckets %v, want %v", h.buckets, want)
+	}
+	if h.count != 5 || h.sum != 60+120+300+3600+9000 {
+		t.Errorf("got count %d and sum %v, want 5 and 13080", h.count, h.sum)
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+// Copyright 2016 Nils Decker
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"fmt"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	web "github.com/ndecker/fritzbox_exporter/fritzbox_web"
+)
+
+// Label values of the periods of the online monitor
+var trafficPeriods = map[string]string{
+	"Today":     "today",
+	"Yesterday": "yesterday",
+	"ThisWeek":  "this_week",
+	"ThisMonth": "this_month",
+	"LastMonth": "last_month",
+}
+
+var (
+	traffic_bytes = prometheus.NewDesc(
+		"fritzbox_traffic_bytes",
+		"Bytes sent and received in the period as counted by the online monitor",
+		[]string{"gateway", "period", "direction"},
+		nil,
+	)
+	traffic_online = prometheus.NewDesc(
+		"fritzbox_traffic_online_seconds",
+		"Online time in the period as counted by the online monitor",
+		[]string{"gateway", "period"},
+		nil,
+	)
+	traffic_connections = prometheus.NewDesc(
+		"fritzbox_traffic_connections",
+		"Number of connections established in the period as counted by the online monitor",
+		[]string{"gateway", "period"},
+		nil,
+	)
+)
+
+// TrafficHistoryCollector exports the totals of the online monitor. They are
+// gauges because the box resets them at the start of each period.
+type TrafficHistoryCollector struct {
+	Gateway string
+	Session *web.Session
+}
+
+func (c *TrafficHistoryCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- traffic_bytes
+	ch <- traffic_online
+	ch <- traffic_connections
+}
+
+func (c *TrafficHistoryCollector) Collect(ch chan<- prometheus.Metric) {
+	counters, err := c.Session.TrafficHistory()
+	if err != nil {
+		fmt.Println("cannot get online monitor:", err)
+		collect_errors.Inc()
+		return
+	}
+
+	for _, t := range counters {
+		period := trafficPeriods[t.Period]
+
+		ch <- prometheus.MustNewConstMetric(traffic_bytes, prometheus.GaugeValue, t.BytesSent, c.Gateway, period, "sent")
+		ch <- prometheus.MustNewConstMetric(traffic_bytes, prometheus.GaugeValue, t.BytesReceived, c.Gateway, period, "received")
+		ch <- prometheus.MustNewConstMetric(traffic_online, prometheus.GaugeValue, t.OnlineTime, c.Gateway, period)
+		ch <- prometheus.MustNewConstMetric(traffic_connections, prometheus.GaugeValue, t.Connections, c.Gateway, period)
+	}
+}
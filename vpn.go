@@ -0,0 +1,96 @@
+package main
+
+// Copyright 2016 Nils Decker
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"fmt"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	web "github.com/ndecker/fritzbox_exporter/fritzbox_web"
+)
+
+var vpn_labels = []string{"gateway", "name", "type"}
+
+var (
+	vpn_active = prometheus.NewDesc(
+		"fritzbox_vpn_connection_active",
+		"VPN connection is enabled (1 = enabled)",
+		vpn_labels,
+		nil,
+	)
+	vpn_connected = prometheus.NewDesc(
+		"fritzbox_vpn_connection_connected",
+		"VPN tunnel is established (1 = established)",
+		vpn_labels,
+		nil,
+	)
+	vpn_info = prometheus.NewDesc(
+		"fritzbox_vpn_connection_info",
+		"Remote endpoint of a VPN connection",
+		append(vpn_labels, "remote"),
+		nil,
+	)
+	vpn_last_handshake = prometheus.NewDesc(
+		"fritzbox_vpn_connection_last_handshake_timestamp_seconds",
+		"Time of the last WireGuard handshake",
+		vpn_labels,
+		nil,
+	)
+	vpn_bytes = prometheus.NewDesc(
+		"fritzbox_vpn_connection_bytes",
+		"Bytes transferred through the VPN tunnel",
+		append(vpn_labels, "direction"),
+		nil,
+	)
+)
+
+// VPNCollector exports the IPSec and WireGuard connections of the box.
+type VPNCollector struct {
+	Gateway string
+	Session *web.Session
+}
+
+func (c *VPNCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- vpn_active
+	ch <- vpn_connected
+	ch <- vpn_info
+	ch <- vpn_last_handshake
+	ch <- vpn_bytes
+}
+
+func (c *VPNCollector) Collect(ch chan<- prometheus.Metric) {
+	connections, err := c.Session.VPNConnections()
+	if err != nil {
+		fmt.Println("cannot get VPN connections:", err)
+		collect_errors.Inc()
+		return
+	}
+
+	for _, conn := range connections {
+		labels := []string{c.Gateway, conn.Name.String(), conn.Type.String()}
+
+		emitValue(ch, vpn_active, prometheus.GaugeValue, conn.Active, labels...)
+		emitValue(ch, vpn_connected, prometheus.GaugeValue, conn.Connected, labels...)
+		ch <- prometheus.MustNewConstMetric(vpn_info, prometheus.GaugeValue, 1, append(labels, conn.RemoteEndpoint.String())...)
+
+		// 0 if there was no handshake yet
+		if t, ok := conn.LastHandshake.Float(); ok && t > 0 {
+			ch <- prometheus.MustNewConstMetric(vpn_last_handshake, prometheus.GaugeValue, t, labels...)
+		}
+		emitValue(ch, vpn_bytes, prometheus.CounterValue, conn.BytesReceived, append(labels, "received")...)
+		emitValue(ch, vpn_bytes, prometheus.CounterValue, conn.BytesSent, append(labels, "sent")...)
+	}
+}
@@ -0,0 +1,211 @@
+package main
+
+// Copyright 2016 Nils Decker
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	upnp "github.com/ndecker/fritzbox_exporter/fritzbox_upnp"
+)
+
+const igdIPService = "urn:schemas-upnp-org:service:WANIPConnection:1"
+
+// Services that report the external IPv4 address, in order of preference
+var ipv4Services = []string{
+	igdIPService,
+	"urn:dslforum-org:service:WANPPPConnection:1",
+	"urn:dslforum-org:service:WANIPConnection:1",
+}
+
+// Address families of the change counters
+var addressFamilies = []string{"ipv4", "ipv6", "ipv6_prefix"}
+
+var (
+	wan_ipv4_info = prometheus.NewDesc(
+		"fritzbox_wan_ipv4_info",
+		"External IPv4 address of the WAN connection",
+		[]string{"gateway", "address"},
+		nil,
+	)
+	wan_ipv6_info = prometheus.NewDesc(
+		"fritzbox_wan_ipv6_info",
+		"External IPv6 address of the WAN connection",
+		[]string{"gateway", "address", "prefix_length"},
+		nil,
+	)
+	wan_ipv6_prefix_info = prometheus.NewDesc(
+		"fritzbox_wan_ipv6_prefix_info",
+		"IPv6 prefix delegated to the FRITZ!Box",
+		[]string{"gateway", "prefix", "prefix_length"},
+		nil,
+	)
+	wan_ipv6_valid_lifetime = prometheus.NewDesc(
+		"fritzbox_wan_ipv6_valid_lifetime_seconds",
+		"Remaining valid lifetime of the IPv6 address or prefix",
+		[]string{"gateway", "family"},
+		nil,
+	)
+	wan_ipv6_preferred_lifetime = prometheus.NewDesc(
+		"fritzbox_wan_ipv6_preferred_lifetime_seconds",
+		"Remaining preferred lifetime of the IPv6 address or prefix",
+		[]string{"gateway", "family"},
+		nil,
+	)
+	wan_address_changes = prometheus.NewDesc(
+		"fritzbox_wan_address_changes",
+		"Number of changes of the address or prefix since the exporter started",
+		[]string{"gateway", "family"},
+		nil,
+	)
+	wan_address_last_change = prometheus.NewDesc(
+		"fritzbox_wan_address_last_change_timestamp_seconds",
+		"Time when the exporter noticed the last change of the address or prefix",
+		[]string{"gateway", "family"},
+		nil,
+	)
+)
+
+// WANAddressCollector exports the external addresses of the WAN connection
+// and counts their changes. Changes are noticed at scrape time, a change and
+// its reversal between two scrapes are not seen.
+type WANAddressCollector struct {
+	Fritzbox *FritzboxCollector
+
+	mu         sync.Mutex
+	last       map[string]string
+	changes    map[string]uint64
+	lastChange map[string]time.Time
+}
+
+func NewWANAddressCollector(fc *FritzboxCollector) *WANAddressCollector {
+	return &WANAddressCollector{
+		Fritzbox:   fc,
+		last:       make(map[string]string),
+		changes:    make(map[string]uint64),
+		lastChange: make(map[string]time.Time),
+	}
+}
+
+func (c *WANAddressCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- wan_ipv4_info
+	ch <- wan_ipv6_info
+	ch <- wan_ipv6_prefix_info
+	ch <- wan_ipv6_valid_lifetime
+	ch <- wan_ipv6_preferred_lifetime
+	ch <- wan_address_changes
+	ch <- wan_address_last_change
+}
+
+func (c *WANAddressCollector) Collect(ch chan<- prometheus.Metric) {
+	root := c.Fritzbox.currentRoot()
+	if root == nil {
+		return
+	}
+
+	err := c.collect(ch, root)
+	if err != nil {
+		fmt.Println("cannot collect WAN addresses:", err)
+		collect_errors.Inc()
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	gateway := c.Fritzbox.Gateway
+	for _, family := range addressFamilies {
+		if _, ok := c.last[family]; !ok {
+			continue
+		}
+
+		ch <- prometheus.MustNewConstMetric(wan_address_changes, prometheus.CounterValue, float64(c.changes[family]), gateway, family)
+		if t, ok := c.lastChange[family]; ok {
+			ch <- prometheus.MustNewConstMetric(wan_address_last_change, prometheus.GaugeValue, float64(t.Unix()), gateway, family)
+		}
+	}
+}
+
+func (c *WANAddressCollector) collect(ch chan<- prometheus.Metric, root *upnp.Root) error {
+	gateway := c.Fritzbox.Gateway
+
+	for _, service := range ipv4Services {
+		if !root.HasAction(service, "GetExternalIPAddress") {
+			continue
+		}
+
+		res, err := root.Call(service, "GetExternalIPAddress")
+		if err != nil {
+			return err
+		}
+
+		address := res.GetString("ExternalIPAddress")
+		if address != "" {
+			ch <- prometheus.MustNewConstMetric(wan_ipv4_info, prometheus.GaugeValue, 1, gateway, address)
+			c.update("ipv4", address)
+		}
+		break
+	}
+
+	if root.HasAction(igdIPService, "X_AVM_DE_GetExternalIPv6Address") {
+		res, err := root.Call(igdIPService, "X_AVM_DE_GetExternalIPv6Address")
+		if err != nil {
+			return err
+		}
+
+		address := res.GetString("ExternalIPv6Address")
+		if address != "" {
+			ch <- prometheus.MustNewConstMetric(wan_ipv6_info, prometheus.GaugeValue, 1, gateway, address, res.GetString("PrefixLength"))
+			emitResult(ch, wan_ipv6_valid_lifetime, prometheus.GaugeValue, res, "ValidLifetime", gateway, "ipv6")
+			emitResult(ch, wan_ipv6_preferred_lifetime, prometheus.GaugeValue, res, "PreferedLifetime", gateway, "ipv6")
+			c.update("ipv6", address)
+		}
+	}
+
+	if root.HasAction(igdIPService, "X_AVM_DE_GetIPv6Prefix") {
+		res, err := root.Call(igdIPService, "X_AVM_DE_GetIPv6Prefix")
+		if err != nil {
+			return err
+		}
+
+		prefix := res.GetString("IPv6Prefix")
+		if prefix != "" {
+			length := res.GetString("PrefixLength")
+			ch <- prometheus.MustNewConstMetric(wan_ipv6_prefix_info, prometheus.GaugeValue, 1, gateway, prefix, length)
+			emitResult(ch, wan_ipv6_valid_lifetime, prometheus.GaugeValue, res, "ValidLifetime", gateway, "ipv6_prefix")
+			emitResult(ch, wan_ipv6_preferred_lifetime, prometheus.GaugeValue, res, "PreferedLifetime", gateway, "ipv6_prefix")
+			c.update("ipv6_prefix", prefix+"/"+length)
+		}
+	}
+
+	return nil
+}
+
+// update remembers the current address of family. The first address seen is
+// not counted as change. An address that is lost while the connection is down
+// is not counted either, only a different address afterwards.
+func (c *WANAddressCollector) update(family, address string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	last, ok := c.last[family]
+	if ok && last != address {
+		c.changes[family]++
+		c.lastChange[family] = time.Now()
+	}
+	c.last[family] = address
+}
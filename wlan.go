@@ -0,0 +1,195 @@
+package main
+
+// Copyright 2016 Nils Decker
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	upnp "github.com/ndecker/fritzbox_exporter/fritzbox_upnp"
+)
+
+// The box has one WLANConfiguration instance per radio and one for the guest network:
+// 1 = 2.4 GHz, 2 = 5 GHz, 3 = guest (or 6 GHz on tri-band models), 4 = guest on tri-band models
+const wlanServicePrefix = "urn:dslforum-org:service:WLANConfiguration:"
+const wlanMaxInstances = 4
+
+var wlan_labels = []string{"gateway", "instance", "band", "ssid"}
+var wlan_station_labels = append(wlan_labels, "mac", "ip")
+
+var (
+	wlan_enabled = prometheus.NewDesc(
+		"fritzbox_wlan_enabled",
+		"WLAN is enabled (1 = enabled)",
+		wlan_labels,
+		nil,
+	)
+	wlan_up = prometheus.NewDesc(
+		"fritzbox_wlan_up",
+		"WLAN status (Up = 1)",
+		wlan_labels,
+		nil,
+	)
+	wlan_channel = prometheus.NewDesc(
+		"fritzbox_wlan_channel",
+		"Channel used by the WLAN",
+		wlan_labels,
+		nil,
+	)
+	wlan_info = prometheus.NewDesc(
+		"fritzbox_wlan_info",
+		"Standard, BSSID and access point type of the WLAN",
+		append(wlan_labels, "standard", "bssid", "ap_type"),
+		nil,
+	)
+	wlan_associations = prometheus.NewDesc(
+		"fritzbox_wlan_associations",
+		"Number of associated stations",
+		wlan_labels,
+		nil,
+	)
+	wlan_station_signal = prometheus.NewDesc(
+		"fritzbox_wlan_station_signal_percent",
+		"Signal strength of an associated station",
+		wlan_station_labels,
+		nil,
+	)
+	wlan_station_speed = prometheus.NewDesc(
+		"fritzbox_wlan_station_speed_mbps",
+		"Link speed of an associated station in Mbit/s",
+		wlan_station_labels,
+		nil,
+	)
+)
+
+// WLANCollector exports the state of all WLAN radios and SSIDs.
+type WLANCollector struct {
+	Fritzbox *FritzboxCollector
+	Stations bool // Export metrics per associated station
+}
+
+func (c *WLANCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- wlan_enabled
+	ch <- wlan_up
+	ch <- wlan_channel
+	ch <- wlan_info
+	ch <- wlan_associations
+	if c.Stations {
+		ch <- wlan_station_signal
+		ch <- wlan_station_speed
+	}
+}
+
+func (c *WLANCollector) Collect(ch chan<- prometheus.Metric) {
+	root := c.Fritzbox.currentRoot()
+	if root == nil {
+		return
+	}
+
+	for i := 1; i <= wlanMaxInstances; i++ {
+		service := wlanServicePrefix + strconv.Itoa(i)
+		if root.Services[service] == nil {
+			continue
+		}
+
+		err := c.collectInstance(ch, root, service, strconv.Itoa(i))
+		if err != nil {
+			fmt.Printf("cannot collect %s: %s\n", service, err)
+			collect_errors.Inc()
+		}
+	}
+}
+
+func (c *WLANCollector) collectInstance(ch chan<- prometheus.Metric, root *upnp.Root, service, instance string) error {
+	info, err := root.Call(service, "GetInfo")
+	if err != nil {
+		return err
+	}
+
+	// only newer firmware has the frequency band and the access point type
+	var ext upnp.Result
+	if root.HasAction(service, "X_AVM-DE_GetWLANExtInfo") {
+		ext, err = root.Call(service, "X_AVM-DE_GetWLANExtInfo")
+		if err != nil {
+			return err
+		}
+	}
+
+	labels := []string{c.Fritzbox.Gateway, instance, wlanBand(info, ext), info.GetString("SSID")}
+
+	emitResult(ch, wlan_enabled, prometheus.GaugeValue, info, "Enable", labels...)
+	emitResult(ch, wlan_channel, prometheus.GaugeValue, info, "Channel", labels...)
+
+	var up float64
+	if info.GetString("Status") == "Up" {
+		up = 1
+	}
+	ch <- prometheus.MustNewConstMetric(wlan_up, prometheus.GaugeValue, up, labels...)
+
+	ch <- prometheus.MustNewConstMetric(wlan_info, prometheus.GaugeValue, 1,
+		append(labels, info.GetString("Standard"), info.GetString("BSSID"), ext.GetString("X_AVM-DE_APType"))...)
+
+	assoc, err := root.Call(service, "GetTotalAssociations")
+	if err != nil {
+		return err
+	}
+	emitResult(ch, wlan_associations, prometheus.GaugeValue, assoc, "TotalAssociations", labels...)
+
+	if !c.Stations {
+		return nil
+	}
+
+	n, _ := assoc.GetFloat("TotalAssociations")
+	for i := 0; i < int(n); i++ {
+		station, err := root.Call(service, "GetGenericAssociatedDeviceInfo",
+			upnp.ActionArgument{Name: "NewAssociatedDeviceIndex", Value: i})
+		if err != nil {
+			return err
+		}
+
+		stationLabels := append(labels,
+			station.GetString("AssociatedDeviceMACAddress"),
+			station.GetString("AssociatedDeviceIPAddress"),
+		)
+		emitResult(ch, wlan_station_signal, prometheus.GaugeValue, station, "X_AVM-DE_SignalStrength", stationLabels...)
+		emitResult(ch, wlan_station_speed, prometheus.GaugeValue, station, "X_AVM-DE_Speed", stationLabels...)
+	}
+	return nil
+}
+
+// wlanBand returns the frequency band of a WLAN. Older firmware does not report
+// the band, it is guessed from the channel then.
+func wlanBand(info, ext upnp.Result) string {
+	switch ext.GetString("X_AVM-DE_FrequencyBand") {
+	case "2400":
+		return "2.4GHz"
+	case "5000":
+		return "5GHz"
+	case "6000":
+		return "6GHz"
+	}
+
+	channel, ok := info.GetFloat("Channel")
+	switch {
+	case !ok || channel == 0:
+		return ""
+	case channel <= 14:
+		return "2.4GHz"
+	default:
+		return "5GHz"
+	}
+}